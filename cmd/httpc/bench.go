@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"os"
+	"sort"
+	"strings"
+)
+
+const histogramWidth = 40
+
+func benchCommand(args []string) {
+	cmdBench := flag.NewFlagSet("bench", flag.ExitOnError)
+
+	var headerPtr flagList
+	requestsPtr := cmdBench.Int("n", 200, libhttpc.HelpTextBenchRequests)
+	concurrencyPtr := cmdBench.Int("c", 10, libhttpc.HelpTextBenchConcurrency)
+	ratePtr := cmdBench.Float64("rate", 0, libhttpc.HelpTextBenchRate)
+	durationPtr := cmdBench.Duration("duration", 0, libhttpc.HelpTextBenchDuration)
+	methodPtr := cmdBench.String("m", "GET", libhttpc.HelpTextBenchMethod)
+	dataPtr := cmdBench.String("d", libhttpc.BlankString, libhttpc.HelpTextData)
+	common := addCommonFlags(cmdBench)
+	jsonPtr := cmdBench.Bool("json", false, libhttpc.HelpTextBenchJSON)
+	cmdBench.Var(&headerPtr, "h", libhttpc.HelpTextHeader)
+	_ = cmdBench.Parse(args)
+
+	if cmdBench.NArg() != 1 {
+		fmt.Println(libhttpc.HelpTextBench)
+		return
+	}
+
+	profile, transport, err := common.apply()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	headers := libhttpc.RequestHeader{}
+	for _, headerString := range headerPtr {
+		headerSet := strings.SplitN(headerString, ":", 2)
+		if len(headerSet) == 2 {
+			headers[headerSet[0]] = headerSet[1]
+		}
+	}
+	profile.ApplyHeaders(headers)
+
+	requests := *requestsPtr
+	if *durationPtr > 0 && !flagWasSet(cmdBench, "n") {
+		requests = 0
+	}
+
+	report, err := libhttpc.RunBenchmark(libhttpc.BenchOptions{
+		Method:      strings.ToUpper(*methodPtr),
+		URL:         profile.ResolveURL(cmdBench.Arg(0)),
+		Transport:   transport,
+		Headers:     headers,
+		Body:        []byte(*dataPtr),
+		Requests:    requests,
+		Concurrency: *concurrencyPtr,
+		Rate:        *ratePtr,
+		Duration:    *durationPtr,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *jsonPtr {
+		encoded, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(encoded))
+	} else {
+		printBenchReport(report)
+	}
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func flagWasSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func printBenchReport(report *libhttpc.BenchReport) {
+	fmt.Printf("Summary:\n")
+	fmt.Printf("  Requests:\t%d (%d succeeded, %d failed)\n", report.Requests, report.Succeeded, report.Failed)
+	fmt.Printf("  Elapsed:\t%.4f s\n", report.Elapsed)
+	fmt.Printf("  Throughput:\t%.2f req/s\n", report.Throughput)
+
+	fmt.Printf("\nLatency:\n")
+	fmt.Printf("  min %.2f ms, mean %.2f ms, max %.2f ms\n", report.Latency.Min, report.Latency.Mean, report.Latency.Max)
+	fmt.Printf("  p50 %.2f ms, p90 %.2f ms, p99 %.2f ms\n", report.Latency.P50, report.Latency.P90, report.Latency.P99)
+
+	if len(report.Histogram) > 0 {
+		fmt.Printf("\nHistogram:\n")
+		largest := 0
+		for _, bucket := range report.Histogram {
+			if bucket.Count > largest {
+				largest = bucket.Count
+			}
+		}
+		for _, bucket := range report.Histogram {
+			bar := 0
+			if largest > 0 {
+				bar = bucket.Count * histogramWidth / largest
+			}
+			fmt.Printf("  %10.2f ms [%d]\t|%s\n", bucket.UpperBound, bucket.Count, strings.Repeat("■", bar))
+		}
+	}
+
+	if len(report.StatusCodes) > 0 {
+		fmt.Printf("\nStatus codes:\n")
+		codes := []int{}
+		for code := range report.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Printf("  [%d]\t%d responses\n", code, report.StatusCodes[code])
+		}
+	}
+
+	if len(report.Errors) > 0 {
+		fmt.Printf("\nErrors:\n")
+		kinds := []string{}
+		for kind := range report.Errors {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Printf("  [%d]\t%s\n", report.Errors[kind], kind)
+		}
+	}
+}
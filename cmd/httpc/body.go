@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// requestBody is a body that is either held in memory or streamed from a
+// file. close releases the file and any spooled copy of stdin. content or
+// source keep what the body was made from for --export.
+type requestBody struct {
+	reader  io.Reader
+	length  int64
+	close   func()
+	content []byte
+	source  string
+}
+
+func memoryBody(content []byte) *requestBody {
+	return &requestBody{reader: bytes.NewReader(content), length: int64(len(content)), close: func() {}, content: content}
+}
+
+// openRequestBody opens the body given by one of -d, --data-binary or -f.
+// '-d @file' and '-d @-' read a file or stdin with CR and LF stripped like
+// curl does; '--data-binary @file', '-f file' and '-f -' stream the bytes
+// unchanged.
+func openRequestBody(data string, dataBinary string, file string) (*requestBody, error) {
+	given := 0
+	for _, source := range []string{data, dataBinary, file} {
+		if source != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return nil, fmt.Errorf("Only one of -d, --data-binary or -f can be used")
+	}
+
+	switch {
+	case strings.HasPrefix(data, "@"):
+		body, err := openBodySource(strings.TrimPrefix(data, "@"))
+		if err != nil {
+			return nil, err
+		}
+		defer body.close()
+		content, err := ioutil.ReadAll(body.reader)
+		if err != nil {
+			return nil, err
+		}
+		return memoryBody(stripNewlines(content)), nil
+	case data != "":
+		return memoryBody([]byte(data)), nil
+	case strings.HasPrefix(dataBinary, "@"):
+		return openBodySource(strings.TrimPrefix(dataBinary, "@"))
+	case dataBinary != "":
+		return memoryBody([]byte(dataBinary)), nil
+	case file != "":
+		return openBodySource(file)
+	}
+	return memoryBody(nil), nil
+}
+
+// openBodySource opens a file, or stdin for "-", with a known length.
+func openBodySource(path string) (*requestBody, error) {
+	if path == "-" {
+		body, err := openStdin()
+		if err == nil {
+			body.source = path
+		}
+		return body, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &requestBody{reader: file, length: info.Size(), close: func() { file.Close() }, source: path}, nil
+}
+
+// openStdin streams stdin directly when it is redirected from a file.
+// HTTP/1.0 needs the Content-Length up front, so a pipe is spooled to a
+// temporary file rather than into memory.
+func openStdin() (*requestBody, error) {
+	info, err := os.Stdin.Stat()
+	if err == nil && info.Mode().IsRegular() {
+		return &requestBody{reader: os.Stdin, length: info.Size(), close: func() {}}, nil
+	}
+
+	spool, err := ioutil.TempFile("", "httpc-stdin-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+
+	length, err := io.Copy(spool, os.Stdin)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	return &requestBody{reader: spool, length: length, close: cleanup}, nil
+}
+
+// formBody encodes -F fields as multipart/form-data. 'name=value' adds a
+// field and 'name=@path' attaches a file, as in curl.
+func formBody(fields []string) (*requestBody, string, error) {
+	var content bytes.Buffer
+	writer := multipart.NewWriter(&content)
+	for _, field := range fields {
+		nameValue := strings.SplitN(field, "=", 2)
+		if len(nameValue) != 2 || nameValue[0] == "" {
+			return nil, "", fmt.Errorf("Invalid form field '%s', expected name=value or name=@file", field)
+		}
+		name, value := nameValue[0], nameValue[1]
+
+		if !strings.HasPrefix(value, "@") {
+			if err := writer.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		path := strings.TrimPrefix(value, "@")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		part, err := writer.CreateFormFile(name, filepath.Base(path))
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return memoryBody(content.Bytes()), writer.FormDataContentType(), nil
+}
+
+func stripNewlines(content []byte) []byte {
+	stripped := bytes.ReplaceAll(content, []byte("\r"), nil)
+	return bytes.ReplaceAll(stripped, []byte("\n"), nil)
+}
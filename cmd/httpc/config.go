@@ -0,0 +1,287 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"httpc/pkg/rudp"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// commonFlags are the settings every request-making command accepts and that
+// can also come from the config file.
+type commonFlags struct {
+	profile   *string
+	transport *string
+	router    *string
+	timeout   *time.Duration
+	window    *int
+	rudpStats *bool
+
+	congestion *string
+	cwndTrace  *string
+
+	limitRate  *string
+	unixSocket *string
+	resolve    *flagList
+	connectTo  *flagList
+
+	userAgent   *string
+	requestID   *bool
+	logRequests *bool
+	sign        *string
+	awsSigV4    *string
+
+	oauth2TokenURL     *string
+	oauth2ClientID     *string
+	oauth2ClientSecret *string
+	oauth2Scope        *string
+	oauth2RefreshToken *string
+
+	cassette     *string
+	cassetteMode *string
+	match        *string
+}
+
+func addCommonFlags(flags *flag.FlagSet) *commonFlags {
+	common := addHandshakeFlags(flags)
+	common.transport = flags.String("transport", libhttpc.BlankString, libhttpc.HelpTextTransport)
+	common.router = flags.String("router", libhttpc.BlankString, libhttpc.HelpTextRouter)
+	common.window = flags.Int("window", 0, libhttpc.HelpTextWindow)
+	common.rudpStats = flags.Bool("rudp-stats", false, libhttpc.HelpTextRudpStats)
+	common.congestion = flags.String("congestion", rudp.CongestionReno, libhttpc.HelpTextCongestion)
+	common.cwndTrace = flags.String("cwnd-trace", libhttpc.BlankString, libhttpc.HelpTextCwndTrace)
+	common.logRequests = flags.Bool("log-requests", false, libhttpc.HelpTextLogRequests)
+	common.cassette = flags.String("cassette", libhttpc.BlankString, libhttpc.HelpTextCassette)
+	common.cassetteMode = flags.String("cassette-mode", libhttpc.CassetteAuto, libhttpc.HelpTextCassetteMode)
+	common.match = flags.String("match", "method,url", libhttpc.HelpTextMatch)
+	return common
+}
+
+// addHandshakeFlags registers the flags that apply to websockets and event
+// streams. They always go over TCP and are not sent through the client, so
+// the transport, logging and cassette flags keep their defaults; the
+// middlewares adding headers apply to their handshake.
+func addHandshakeFlags(flags *flag.FlagSet) *commonFlags {
+	transport := libhttpc.TransportTCP
+	congestion := rudp.CongestionReno
+	cassetteMode := libhttpc.CassetteAuto
+	match := "method,url"
+	common := &commonFlags{
+		profile:   flags.String("profile", libhttpc.BlankString, libhttpc.HelpTextProfile),
+		transport: &transport,
+		router:    new(string),
+		timeout:   flags.Duration("timeout", 0, libhttpc.HelpTextTimeout),
+		window:    new(int),
+		rudpStats: new(bool),
+
+		congestion: &congestion,
+		cwndTrace:  new(string),
+
+		limitRate:  flags.String("limit-rate", libhttpc.BlankString, libhttpc.HelpTextLimitRate),
+		unixSocket: flags.String("unix-socket", libhttpc.BlankString, libhttpc.HelpTextUnixSocket),
+		resolve:    &flagList{},
+		connectTo:  &flagList{},
+
+		userAgent:   flags.String("user-agent", libhttpc.BlankString, libhttpc.HelpTextUserAgent),
+		requestID:   flags.Bool("request-id", false, libhttpc.HelpTextRequestID),
+		logRequests: new(bool),
+		sign:        flags.String("sign", libhttpc.BlankString, libhttpc.HelpTextSign),
+		awsSigV4:    flags.String("aws-sigv4", libhttpc.BlankString, libhttpc.HelpTextAwsSigV4),
+
+		oauth2TokenURL:     flags.String("oauth2-token-url", libhttpc.BlankString, libhttpc.HelpTextOAuth2TokenURL),
+		oauth2ClientID:     flags.String("oauth2-client-id", libhttpc.BlankString, libhttpc.HelpTextOAuth2ClientID),
+		oauth2ClientSecret: flags.String("oauth2-client-secret", libhttpc.BlankString, libhttpc.HelpTextOAuth2ClientSecret),
+		oauth2Scope:        flags.String("oauth2-scope", libhttpc.BlankString, libhttpc.HelpTextOAuth2Scope),
+		oauth2RefreshToken: flags.String("oauth2-refresh-token", libhttpc.BlankString, libhttpc.HelpTextOAuth2RefreshToken),
+
+		cassette:     new(string),
+		cassetteMode: &cassetteMode,
+		match:        &match,
+	}
+	flags.Var(common.resolve, "resolve", libhttpc.HelpTextResolve)
+	flags.Var(common.connectTo, "connect-to", libhttpc.HelpTextConnectTo)
+	return common
+}
+
+// apply loads the selected profile, lets the command line override it and
+// configures the client. It returns the profile and the transport to use.
+func (common *commonFlags) apply() (*libhttpc.Profile, string, error) {
+	config, err := libhttpc.LoadConfig(libhttpc.DefaultConfigPath())
+	if err != nil {
+		return nil, libhttpc.BlankString, err
+	}
+	profile, err := config.Profile(*common.profile)
+	if err != nil {
+		return nil, libhttpc.BlankString, err
+	}
+
+	router := profile.Router
+	if *common.router != libhttpc.BlankString {
+		router = *common.router
+	}
+	if router != libhttpc.BlankString {
+		if err := libhttpc.SetRouter(router); err != nil {
+			return nil, libhttpc.BlankString, err
+		}
+	}
+
+	timeout, err := profile.TimeoutDuration()
+	if err != nil {
+		return nil, libhttpc.BlankString, err
+	}
+	if *common.timeout > 0 {
+		timeout = *common.timeout
+	}
+	libhttpc.SetTimeout(timeout)
+	libhttpc.SetWindow(*common.window)
+	congestion, err := rudp.ParseCongestion(*common.congestion)
+	if err != nil {
+		return nil, libhttpc.BlankString, err
+	}
+	libhttpc.SetCongestion(congestion)
+	if *common.cwndTrace != libhttpc.BlankString {
+		// left open until the process exits, every write goes straight out
+		traceFile, err := os.Create(*common.cwndTrace)
+		if err != nil {
+			return nil, libhttpc.BlankString, err
+		}
+		libhttpc.SetCwndTrace(rudp.NewTrace(traceFile))
+	}
+	if *common.rudpStats {
+		logger := log.New(os.Stderr, libhttpc.BlankString, 0)
+		libhttpc.SetUDPStatsHandler(func(address string, stats rudp.Stats) {
+			logger.Printf("rudp %s: %s", address, stats)
+		})
+	}
+
+	if *common.limitRate != libhttpc.BlankString {
+		rate, err := libhttpc.ParseRate(*common.limitRate)
+		if err != nil {
+			return nil, libhttpc.BlankString, err
+		}
+		libhttpc.SetRateLimit(rate)
+	}
+
+	transport := libhttpc.TransportUDP
+	if profile.Transport != libhttpc.BlankString {
+		transport = profile.Transport
+	}
+	if *common.transport != libhttpc.BlankString {
+		transport = *common.transport
+	}
+
+	if err := common.applyDialer(transport); err != nil {
+		return nil, libhttpc.BlankString, err
+	}
+
+	if *common.cassette != libhttpc.BlankString {
+		cassette, err := libhttpc.NewCassette(*common.cassette, *common.cassetteMode, libhttpc.Client{})
+		if err != nil {
+			return nil, libhttpc.BlankString, err
+		}
+		if cassette.Matchers, err = libhttpc.ParseMatchers(*common.match); err != nil {
+			return nil, libhttpc.BlankString, err
+		}
+		libhttpc.SetClient(cassette)
+	}
+
+	if err := common.applyMiddleware(); err != nil {
+		return nil, libhttpc.BlankString, err
+	}
+	return profile, transport, nil
+}
+
+// applyMiddleware installs the middlewares selected on the command line.
+// Logging is outermost so the logged duration covers the others, signing
+// innermost so it covers the headers they add.
+func (common *commonFlags) applyMiddleware() error {
+	if *common.logRequests {
+		libhttpc.Use(libhttpc.LoggingMiddleware(log.New(os.Stderr, "httpc: ", log.LstdFlags)))
+	}
+	if *common.userAgent != libhttpc.BlankString {
+		libhttpc.Use(libhttpc.UserAgentMiddleware(*common.userAgent))
+	}
+	if *common.requestID {
+		libhttpc.Use(libhttpc.RequestIDMiddleware(libhttpc.BlankString))
+	}
+	// each of them sets Authorization, the innermost one would win silently
+	authorizations := 0
+	for _, value := range []string{*common.oauth2TokenURL, *common.sign, *common.awsSigV4} {
+		if value != libhttpc.BlankString {
+			authorizations++
+		}
+	}
+	if authorizations > 1 {
+		return fmt.Errorf("--oauth2-token-url, --sign and --aws-sigv4 all set the Authorization header, use only one")
+	}
+	if *common.oauth2TokenURL != libhttpc.BlankString {
+		libhttpc.UseCredentials(libhttpc.OAuth2Middleware(libhttpc.NewOAuth2Source(libhttpc.OAuth2Config{
+			TokenURL:     *common.oauth2TokenURL,
+			ClientID:     *common.oauth2ClientID,
+			ClientSecret: *common.oauth2ClientSecret,
+			Scopes:       strings.Fields(*common.oauth2Scope),
+			RefreshToken: *common.oauth2RefreshToken,
+		})))
+	}
+	if *common.sign != libhttpc.BlankString {
+		signer, err := libhttpc.ParseHMACSigner(*common.sign)
+		if err != nil {
+			return err
+		}
+		libhttpc.UseCredentials(libhttpc.SigningMiddleware(signer))
+	}
+	if *common.awsSigV4 != libhttpc.BlankString {
+		signer, err := libhttpc.ParseSigV4Signer(*common.awsSigV4)
+		if err != nil {
+			return err
+		}
+		libhttpc.UseCredentials(libhttpc.SigningMiddleware(signer))
+	}
+	return nil
+}
+
+// applyDialer routes connections through the Unix socket and address
+// overrides given on the command line. As in curl, --connect-to is applied
+// first and --resolve then applies to the resulting host. The overrides
+// apply to the peer of the UDP transport too, but a Unix socket only
+// carries TCP requests.
+func (common *commonFlags) applyDialer(transport string) error {
+	dial := libhttpc.DialFunc(libhttpc.DefaultDialer)
+	if *common.unixSocket != libhttpc.BlankString {
+		if transport != libhttpc.TransportTCP {
+			return fmt.Errorf("--unix-socket needs --transport tcp, not %s", transport)
+		}
+		dial = libhttpc.UnixSocketDialer(*common.unixSocket)
+	}
+
+	var resolves []libhttpc.AddressOverride
+	for _, spec := range *common.resolve {
+		override, err := libhttpc.ParseResolve(spec)
+		if err != nil {
+			return err
+		}
+		resolves = append(resolves, override)
+	}
+	if len(resolves) > 0 {
+		dial = libhttpc.OverrideDialer(dial, resolves)
+	}
+
+	var connectTos []libhttpc.AddressOverride
+	for _, spec := range *common.connectTo {
+		override, err := libhttpc.ParseConnectTo(spec)
+		if err != nil {
+			return err
+		}
+		connectTos = append(connectTos, override)
+	}
+	if len(connectTos) > 0 {
+		dial = libhttpc.OverrideDialer(dial, connectTos)
+	}
+
+	libhttpc.SetDialer(dial)
+	return nil
+}
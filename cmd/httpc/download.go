@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const progressInterval = 200 * time.Millisecond
+
+// console serialises everything printed while the progress line is drawn.
+var console = &progressDisplay{}
+
+type download struct {
+	url      string
+	output   outputOptions
+	raw      string
+	response *libhttpc.Response
+	err      error
+	done     chan bool
+}
+
+type downloadOptions struct {
+	transport   string
+	headers     libhttpc.RequestHeader
+	verbose     bool
+	globOff     bool
+	parallelMax int
+	outputs     []string
+	output      outputOptions
+	export      string
+}
+
+// planDownloads expands every URL argument. The i-th -o belongs to the i-th
+// URL argument and may refer to its glob values as '#1', '#2', ...
+func planDownloads(arguments []string, profile *libhttpc.Profile, options downloadOptions) ([]*download, error) {
+	downloads := []*download{}
+	for i, argument := range arguments {
+		expansions := []globbedURL{{url: argument}}
+		if !options.globOff {
+			expanded, err := expandURLGlob(argument)
+			if err != nil {
+				return nil, err
+			}
+			expansions = expanded
+		}
+
+		for _, expansion := range expansions {
+			url := profile.ResolveURL(expansion.url)
+			match, _ := regexp.MatchString("^http(s?)://", url)
+			if match == false {
+				url = "https://" + url
+			}
+
+			output := options.output
+			output.path = libhttpc.BlankString
+			if i < len(options.outputs) {
+				output.path = substituteGlobValues(options.outputs[i], expansion.values)
+			}
+			downloads = append(downloads, &download{url: url, output: output, done: make(chan bool)})
+		}
+	}
+	return downloads, nil
+}
+
+// runDownloads fetches up to parallelMax URLs at once. Files are written as
+// soon as they arrive while stdout output keeps the argument order. It
+// returns the number of failed downloads.
+func runDownloads(downloads []*download, options downloadOptions) int {
+	if options.parallelMax < 1 {
+		options.parallelMax = 1
+	}
+
+	if len(downloads) > 1 && isTerminal(os.Stderr) {
+		console.start(len(downloads))
+		defer console.stop()
+	}
+
+	jobs := make(chan *download)
+	for worker := 0; worker < options.parallelMax; worker++ {
+		go func() {
+			for job := range jobs {
+				fetch(job, options)
+				if job.err == nil && job.output.writesFile() {
+					job.err = deliver(job, options.verbose)
+				}
+				console.finish(job.err != nil)
+				close(job.done)
+			}
+		}()
+	}
+	go func() {
+		for _, job := range downloads {
+			jobs <- job
+		}
+		close(jobs)
+	}()
+
+	failed := 0
+	for _, job := range downloads {
+		<-job.done
+		if job.err != nil {
+			failed++
+			console.printf("Error encountered: %s: %s\n", job.url, job.err.Error())
+			continue
+		}
+		if !job.output.writesFile() {
+			if err := deliver(job, options.verbose); err != nil {
+				failed++
+				console.printf("Error encountered: %s: %s\n", job.url, err.Error())
+			}
+		}
+	}
+	if options.export != libhttpc.BlankString {
+		for _, job := range downloads {
+			printExport(options.export, libhttpc.ExportRequest{
+				Transport: options.transport,
+				Method:    "GET",
+				URL:       job.url,
+				Headers:   options.headers,
+			})
+		}
+	}
+	return failed
+}
+
+func fetch(job *download, options downloadOptions) {
+	headers := libhttpc.RequestHeader{}
+	for key, value := range options.headers {
+		headers[key] = value
+	}
+
+	res, err := libhttpc.Send(options.transport, "GET", job.url, headers, nil)
+	if err != nil {
+		job.err = err
+		return
+	}
+	response, err := libhttpc.FromString(res)
+	if err != nil {
+		job.err = err
+		return
+	}
+	if response == nil {
+		job.err = fmt.Errorf("Malformed response")
+		return
+	}
+
+	if response.StatusCode >= 300 && response.StatusCode <= 302 {
+		res, err = libhttpc.HandleRedirects(response, res, options.transport, job.url, headers, 0, func(statusCode int, location string) {
+			console.printf("Encountered status code %d...Redirecting to %s\n", statusCode, location)
+		})
+		if err != nil {
+			job.err = err
+			return
+		}
+		response, err = libhttpc.FromString(res)
+		if err != nil {
+			job.err = err
+			return
+		}
+	}
+
+	job.raw = res
+	job.response = response
+}
+
+func deliver(job *download, verbose bool) error {
+	toWrite, err := job.output.render(job.raw, job.response, verbose)
+	if err != nil {
+		return err
+	}
+	return writeOutput(&job.output, job.url, job.response, toWrite)
+}
+
+func (output *outputOptions) writesFile() bool {
+	return output.path != libhttpc.BlankString || output.remoteName
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressDisplay draws a single aggregated status line on stderr. When it
+// is not started, printf simply prints.
+type progressDisplay struct {
+	mutex    sync.Mutex
+	active   bool
+	total    int
+	finished int
+	failed   int
+	began    time.Time
+	baseline int64
+	quit     chan bool
+	stopped  chan bool
+}
+
+func (display *progressDisplay) start(total int) {
+	display.mutex.Lock()
+	display.active = true
+	display.total = total
+	display.began = time.Now()
+	display.baseline = libhttpc.BytesReceived()
+	display.quit = make(chan bool)
+	display.stopped = make(chan bool)
+	display.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		defer close(display.stopped)
+		for {
+			select {
+			case <-display.quit:
+				return
+			case <-ticker.C:
+				display.mutex.Lock()
+				display.draw()
+				display.mutex.Unlock()
+			}
+		}
+	}()
+}
+
+func (display *progressDisplay) stop() {
+	close(display.quit)
+	<-display.stopped
+
+	display.mutex.Lock()
+	defer display.mutex.Unlock()
+	display.draw()
+	fmt.Fprintln(os.Stderr)
+	display.active = false
+}
+
+func (display *progressDisplay) finish(failed bool) {
+	display.mutex.Lock()
+	defer display.mutex.Unlock()
+	display.finished++
+	if failed {
+		display.failed++
+	}
+}
+
+func (display *progressDisplay) printf(format string, args ...interface{}) {
+	display.mutex.Lock()
+	defer display.mutex.Unlock()
+	if display.active {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	fmt.Printf(format, args...)
+	if display.active {
+		display.draw()
+	}
+}
+
+func (display *progressDisplay) draw() {
+	received := libhttpc.BytesReceived() - display.baseline
+	elapsed := time.Since(display.began).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(received) / elapsed
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K[%d/%d] %d failed, %s received, %s/s",
+		display.finished, display.total, display.failed, formatBytes(float64(received)), formatBytes(rate))
+}
+
+func formatBytes(size float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func startFileServer(t *testing.T) string {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprint(writer, "content")
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// runHttpc runs the command line as main would and returns the exit status.
+func runHttpc(t *testing.T, args ...string) int {
+	defer func(original []string) { os.Args = original }(os.Args)
+	exitStatus = 0
+	os.Args = append([]string{"httpc"}, args...)
+	parseArgs()
+	return exitStatus
+}
+
+func TestGetExitStatusOnOutputFailure(t *testing.T) {
+	url := startFileServer(t)
+	dir := t.TempDir()
+
+	if status := runHttpc(t, "get", "--transport", "tcp", "-o", filepath.Join(dir, "x.txt"), url+"/x.txt"); status != 0 {
+		t.Fatalf("exit status %d for a written file, want 0", status)
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "x.txt")); err != nil || string(content) != "content" {
+		t.Fatalf("file holds %q, %v", content, err)
+	}
+
+	cases := map[string][]string{
+		"missing directory": {"get", "--transport", "tcp", "-o", filepath.Join(dir, "missing", "x.txt"), url + "/x.txt"},
+		"no file name":      {"get", "--transport", "tcp", "-O", url + "/"},
+	}
+	for name, args := range cases {
+		if status := runHttpc(t, args...); status != 1 {
+			t.Errorf("%s: exit status %d, want 1", name, status)
+		}
+	}
+}
+
+func TestRunDownloadsCountsOutputFailures(t *testing.T) {
+	url := startFileServer(t)
+	dir := t.TempDir()
+	downloads := []*download{
+		{url: url + "/a", output: outputOptions{path: filepath.Join(dir, "a")}, done: make(chan bool)},
+		{url: url + "/b", output: outputOptions{path: filepath.Join(dir, "missing", "b")}, done: make(chan bool)},
+		{url: url + "/", output: outputOptions{remoteName: true}, done: make(chan bool)},
+	}
+	if failed := runDownloads(downloads, downloadOptions{transport: libhttpc.TransportTCP, parallelMax: 2}); failed != 2 {
+		t.Fatalf("%d failures, want 2", failed)
+	}
+	if downloads[0].err != nil || downloads[1].err == nil || downloads[2].err == nil {
+		t.Fatalf("errors %v, %v, %v", downloads[0].err, downloads[1].err, downloads[2].err)
+	}
+}
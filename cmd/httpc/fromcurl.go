@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// curlValueOptions maps the curl options that take a value to their long
+// name, curlSwitches does the same for the ones that do not.
+var curlValueOptions = map[string]string{
+	"-X": "--request", "--request": "--request",
+	"-H": "--header", "--header": "--header",
+	"-d": "--data", "--data": "--data", "--data-ascii": "--data",
+	"--data-raw":       "--data-raw",
+	"--data-binary":    "--data-binary",
+	"--data-urlencode": "--data-urlencode",
+	"-F":               "--form", "--form": "--form",
+	"-u": "--user", "--user": "--user",
+	"-o": "--output", "--output": "--output",
+	"-A": "--user-agent", "--user-agent": "--user-agent",
+	"-e": "--referer", "--referer": "--referer",
+	"-b": "--cookie", "--cookie": "--cookie",
+	"-m": "--max-time", "--max-time": "--max-time",
+	"--url":             "--url",
+	"--limit-rate":      "--limit-rate",
+	"--unix-socket":     "--unix-socket",
+	"--resolve":         "--resolve",
+	"--connect-to":      "--connect-to",
+	"--connect-timeout": "--connect-timeout",
+}
+
+var curlSwitches = map[string]string{
+	"-L": "--location", "--location": "--location",
+	"-G": "--get", "--get": "--get",
+	"-i": "--include", "--include": "--include",
+	"-v": "--verbose", "--verbose": "--verbose",
+	"-O": "--remote-name", "--remote-name": "--remote-name",
+	"-g": "--globoff", "--globoff": "--globoff",
+	"-s": "--silent", "--silent": "--silent",
+	"-S": "--show-error", "--show-error": "--show-error",
+	"-k": "--insecure", "--insecure": "--insecure",
+	"-f": "--fail", "--fail": "--fail",
+	"--compressed":  "--compressed",
+	"--create-dirs": "--create-dirs",
+}
+
+// curlIgnoredSwitches have no httpc equivalent and are reported when dropped.
+// -L, -s and -S need no translation: httpc always follows redirects and
+// never prints a progress meter for a single request.
+var curlIgnoredSwitches = []string{"--compressed", "--fail", "--insecure"}
+
+// curlRequest collects the parts of a curl command httpc can reproduce.
+type curlRequest struct {
+	method   string
+	urls     []string
+	headers  []string
+	data     []string
+	binary   string
+	form     []string
+	switches map[string]bool
+	options  []string
+}
+
+// fromCurlCommand translates a curl command line into httpc arguments and
+// either runs them or prints them with --print.
+func fromCurlCommand(args []string) {
+	cmdFromCurl := flag.NewFlagSet("from-curl", flag.ExitOnError)
+	printPtr := cmdFromCurl.Bool("print", false, libhttpc.HelpTextFromCurlPrint)
+	_ = cmdFromCurl.Parse(args)
+
+	words := cmdFromCurl.Args()
+	if len(words) == 1 {
+		split, err := libhttpc.SplitCommandLine(words[0])
+		if err != nil {
+			fmt.Println(err)
+			exitStatus = 1
+			return
+		}
+		words = split
+	}
+	if len(words) > 0 && words[0] == "curl" {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		fmt.Println(libhttpc.HelpTextFromCurl)
+		return
+	}
+
+	request, err := parseCurl(words)
+	if err == nil {
+		args, err = request.httpcArgs()
+	}
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+	if ignored := request.ignored(); len(ignored) > 0 {
+		fmt.Fprintf(os.Stderr, "Ignoring curl options httpc cannot reproduce: %s\n", strings.Join(ignored, ", "))
+	}
+
+	if *printPtr {
+		quoted := []string{"httpc"}
+		for _, arg := range args {
+			quoted = append(quoted, libhttpc.ShellQuote(arg))
+		}
+		fmt.Println(strings.Join(quoted, " "))
+		return
+	}
+	os.Args = append([]string{os.Args[0]}, args...)
+	parseArgs()
+}
+
+func parseCurl(words []string) (*curlRequest, error) {
+	request := &curlRequest{switches: map[string]bool{}}
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if !strings.HasPrefix(word, "-") || word == "-" {
+			request.urls = append(request.urls, word)
+			continue
+		}
+
+		// short options may carry their value ('-XPOST') or be grouped ('-sSL')
+		value, attached := libhttpc.BlankString, false
+		if !strings.HasPrefix(word, "--") && len(word) > 2 {
+			if _, ok := curlValueOptions[word[:2]]; ok {
+				value, attached = word[2:], true
+				word = word[:2]
+			} else {
+				for _, short := range word[1:] {
+					name, ok := curlSwitches["-"+string(short)]
+					if !ok {
+						return nil, fmt.Errorf("Unsupported curl option '-%c' in '%s'", short, word)
+					}
+					request.switches[name] = true
+				}
+				continue
+			}
+		}
+
+		if name, ok := curlSwitches[word]; ok {
+			request.switches[name] = true
+			continue
+		}
+		name, ok := curlValueOptions[word]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported curl option '%s'", word)
+		}
+		if !attached {
+			if i+1 >= len(words) {
+				return nil, fmt.Errorf("Missing value for curl option '%s'", word)
+			}
+			i++
+			value = words[i]
+		}
+		if err := request.set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if len(request.urls) != 1 {
+		return nil, fmt.Errorf("Expected exactly one URL in the curl command, found %d", len(request.urls))
+	}
+	return request, nil
+}
+
+func (request *curlRequest) set(name string, value string) error {
+	switch name {
+	case "--request":
+		request.method = strings.ToUpper(value)
+	case "--header":
+		request.headers = append(request.headers, value)
+	case "--data":
+		request.data = append(request.data, value)
+	case "--data-raw":
+		if strings.HasPrefix(value, "@") {
+			return fmt.Errorf("httpc reads '@' values as files, cannot send --data-raw '%s' literally", value)
+		}
+		request.data = append(request.data, value)
+	case "--data-urlencode":
+		encoded, err := urlEncodeCurlData(value)
+		if err != nil {
+			return err
+		}
+		request.data = append(request.data, encoded)
+	case "--data-binary":
+		request.binary = value
+	case "--form":
+		request.form = append(request.form, value)
+	case "--user":
+		if !strings.Contains(value, ":") {
+			return fmt.Errorf("httpc cannot prompt for a password, use --user user:password")
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte(value))
+		request.headers = append(request.headers, "Authorization: Basic "+credentials)
+	case "--user-agent":
+		request.headers = append(request.headers, "User-Agent: "+value)
+	case "--referer":
+		request.headers = append(request.headers, "Referer: "+value)
+	case "--cookie":
+		if !strings.Contains(value, "=") {
+			return fmt.Errorf("httpc has no cookie jar, --cookie needs name=value pairs")
+		}
+		request.headers = append(request.headers, "Cookie: "+value)
+	case "--url":
+		request.urls = append(request.urls, value)
+	case "--max-time":
+		request.options = append(request.options, "--timeout", value+"s")
+	case "--output":
+		request.options = append(request.options, "-o", value)
+	case "--limit-rate", "--unix-socket", "--resolve", "--connect-to":
+		request.options = append(request.options, name, value)
+	}
+	return nil
+}
+
+// httpcArgs builds the equivalent httpc command line. curl speaks plain HTTP
+// so the TCP transport is always selected.
+func (request *curlRequest) httpcArgs() ([]string, error) {
+	target := request.urls[0]
+	if request.switches["--get"] && len(request.data) > 0 {
+		separator := "?"
+		if strings.Contains(target, "?") {
+			separator = "&"
+		}
+		target += separator + strings.Join(request.data, "&")
+		request.data = nil
+	}
+
+	bodies := 0
+	for _, present := range []bool{len(request.data) > 0, request.binary != libhttpc.BlankString, len(request.form) > 0} {
+		if present {
+			bodies++
+		}
+	}
+	if bodies > 1 {
+		return nil, fmt.Errorf("httpc cannot combine --data, --data-binary and --form in one request")
+	}
+
+	method := request.method
+	if method == libhttpc.BlankString {
+		method = "GET"
+		if bodies > 0 {
+			method = "POST"
+		}
+	}
+	switch {
+	case method == "GET" && bodies > 0:
+		return nil, fmt.Errorf("httpc cannot send a body with GET")
+	case method != "GET" && method != "POST":
+		return nil, fmt.Errorf("httpc only sends GET and POST requests, not %s", method)
+	}
+
+	args := []string{strings.ToLower(method), "--transport", libhttpc.TransportTCP}
+	for _, header := range request.headers {
+		args = append(args, "-h", header)
+	}
+
+	// like curl, -d and --data-binary post form-encoded data by default
+	if (len(request.data) > 0 || request.binary != libhttpc.BlankString) && !hasHeaderArg(request.headers, "Content-Type") {
+		args = append(args, "-h", "Content-Type: application/x-www-form-urlencoded")
+	}
+	switch {
+	case len(request.data) > 1:
+		for _, data := range request.data {
+			if strings.HasPrefix(data, "@") {
+				return nil, fmt.Errorf("httpc cannot join '@' files with other --data values")
+			}
+		}
+		args = append(args, "-d", strings.Join(request.data, "&"))
+	case len(request.data) == 1:
+		args = append(args, "-d", request.data[0])
+	case request.binary != libhttpc.BlankString:
+		args = append(args, "--data-binary", request.binary)
+	}
+	for _, field := range request.form {
+		args = append(args, "-F", field)
+	}
+
+	if request.switches["--include"] || request.switches["--verbose"] {
+		args = append(args, "-v")
+	}
+	if request.switches["--remote-name"] {
+		args = append(args, "-O")
+	}
+	if request.switches["--create-dirs"] {
+		args = append(args, "--create-dirs")
+	}
+	if request.switches["--globoff"] {
+		args = append(args, "--globoff")
+	}
+	args = append(args, request.options...)
+	return append(args, target), nil
+}
+
+// ignored lists the switches of the command that httpc drops.
+func (request *curlRequest) ignored() []string {
+	var ignored []string
+	for _, name := range curlIgnoredSwitches {
+		if request.switches[name] {
+			ignored = append(ignored, name)
+		}
+	}
+	return ignored
+}
+
+// urlEncodeCurlData follows curl's --data-urlencode forms 'content',
+// '=content' and 'name=content'.
+func urlEncodeCurlData(value string) (string, error) {
+	if strings.Contains(value, "@") && !strings.Contains(value, "=") {
+		return libhttpc.BlankString, fmt.Errorf("httpc cannot url-encode files in --data-urlencode '%s'", value)
+	}
+	nameContent := strings.SplitN(value, "=", 2)
+	if len(nameContent) == 1 {
+		return url.QueryEscape(value), nil
+	}
+	if nameContent[0] == libhttpc.BlankString {
+		return url.QueryEscape(nameContent[1]), nil
+	}
+	return nameContent[0] + "=" + url.QueryEscape(nameContent[1]), nil
+}
+
+func hasHeaderArg(headers []string, key string) bool {
+	for _, header := range headers {
+		if strings.EqualFold(strings.TrimSpace(strings.SplitN(header, ":", 2)[0]), key) {
+			return true
+		}
+	}
+	return false
+}
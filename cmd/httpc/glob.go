@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const maxGlobURLs = 100000
+
+// globbedURL is one expansion of a URL pattern together with the values the
+// pattern's ranges took, which '#1', '#2', ... refer to in output names.
+type globbedURL struct {
+	url    string
+	values []string
+}
+
+// expandURLGlob expands curl-style patterns: sets '{a,b,c}', numeric ranges
+// '[1-100]' (zero-padded as '[001-100]', stepped as '[0-100:10]') and letter
+// ranges '[a-z]'. A bracketed IPv6 host such as 'http://[::1]/' is kept as is.
+func expandURLGlob(pattern string) ([]globbedURL, error) {
+	expansions := []globbedURL{{}}
+
+	for len(pattern) > 0 {
+		open := strings.IndexAny(pattern, "[{")
+		if open == -1 {
+			expansions = appendLiteral(expansions, pattern)
+			break
+		}
+		expansions = appendLiteral(expansions, pattern[:open])
+
+		// '[' right after '//' or '@' opens an IPv6 host, not a range
+		if pattern[open] == '[' && (strings.HasSuffix(pattern[:open], "//") || strings.HasSuffix(pattern[:open], "@")) {
+			end := strings.Index(pattern[open:], "]")
+			if end == -1 {
+				return nil, fmt.Errorf("Unmatched '[' in %s", pattern)
+			}
+			expansions = appendLiteral(expansions, pattern[open:open+end+1])
+			pattern = pattern[open+end+1:]
+			continue
+		}
+
+		closer := "]"
+		if pattern[open] == '{' {
+			closer = "}"
+		}
+		end := strings.Index(pattern[open:], closer)
+		if end == -1 {
+			return nil, fmt.Errorf("Unmatched '%c' in %s", pattern[open], pattern)
+		}
+
+		var choices []string
+		var err error
+		if closer == "}" {
+			choices = strings.Split(pattern[open+1:open+end], ",")
+		} else {
+			choices, err = expandRange(pattern[open+1 : open+end])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(expansions)*len(choices) > maxGlobURLs {
+			return nil, fmt.Errorf("Pattern %s expands to more than %d URLs", pattern, maxGlobURLs)
+		}
+
+		next := make([]globbedURL, 0, len(expansions)*len(choices))
+		for _, expansion := range expansions {
+			for _, choice := range choices {
+				values := append(append([]string{}, expansion.values...), choice)
+				next = append(next, globbedURL{url: expansion.url + choice, values: values})
+			}
+		}
+		expansions = next
+		pattern = pattern[open+end+1:]
+	}
+	return expansions, nil
+}
+
+func appendLiteral(expansions []globbedURL, literal string) []globbedURL {
+	for i := range expansions {
+		expansions[i].url += literal
+	}
+	return expansions
+}
+
+func expandRange(spec string) ([]string, error) {
+	step := 1
+	if colon := strings.Index(spec, ":"); colon != -1 {
+		parsed, err := strconv.Atoi(spec[colon+1:])
+		if err != nil || parsed < 1 {
+			return nil, fmt.Errorf("Invalid step in range [%s]", spec)
+		}
+		step = parsed
+		spec = spec[:colon]
+	}
+
+	bounds := strings.SplitN(spec, "-", 2)
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("Invalid range [%s]", spec)
+	}
+
+	values := []string{}
+	if len(bounds[0]) == 1 && len(bounds[1]) == 1 && !isDigit(bounds[0][0]) {
+		if bounds[1][0] < bounds[0][0] {
+			return nil, fmt.Errorf("Invalid range [%s]", spec)
+		}
+		for letter := bounds[0][0]; letter <= bounds[1][0]; letter += byte(step) {
+			values = append(values, string(letter))
+			if int(letter)+step > 255 {
+				break
+			}
+		}
+		return values, nil
+	}
+
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid range [%s]", spec)
+	}
+	last, err := strconv.Atoi(bounds[1])
+	if err != nil || last < first {
+		return nil, fmt.Errorf("Invalid range [%s]", spec)
+	}
+	if last-first > maxGlobURLs {
+		return nil, fmt.Errorf("Range [%s] is too large", spec)
+	}
+
+	width := 0
+	if len(bounds[0]) > 1 && bounds[0][0] == '0' {
+		width = len(bounds[0])
+	}
+	for number := first; number <= last; number += step {
+		values = append(values, fmt.Sprintf("%0*d", width, number))
+	}
+	return values, nil
+}
+
+func isDigit(character byte) bool {
+	return character >= '0' && character <= '9'
+}
+
+// substituteGlobValues replaces '#1', '#2', ... in an output name with the
+// values of the URL's ranges.
+func substituteGlobValues(name string, values []string) string {
+	for i := len(values); i >= 1; i-- {
+		name = strings.ReplaceAll(name, "#"+strconv.Itoa(i), values[i-1])
+	}
+	return name
+}
@@ -4,12 +4,14 @@ import (
 	"flag"
 	"fmt"
 	"httpc/pkg/libhttpc"
-	"io/ioutil"
 	"os"
 	"regexp"
 	"strings"
 )
 
+// exitStatus is set by commands that report failure through the exit code.
+var exitStatus int
+
 type flagList []string
 
 // implements interface
@@ -22,16 +24,15 @@ func (flags *flagList) Set(value string) error {
 	return nil
 }
 
-func writeOutput(outputPtr *string, toWrite []byte) {
-	if *outputPtr != "" {
-		err := ioutil.WriteFile(*outputPtr, toWrite, os.FileMode(os.O_RDWR))
-		if err == nil {
-			fmt.Printf("Successfully written result to %s\n", *outputPtr)
-		} else {
-			fmt.Printf("Error encountered: %s", err.Error())
+// startHAR records every exchange and returns the function that writes them out.
+func startHAR(path string) func() {
+	recorder := libhttpc.NewHARRecorder()
+	libhttpc.StartRecording(recorder)
+	return func() {
+		libhttpc.StopRecording()
+		if err := recorder.WriteFile(path); err != nil {
+			fmt.Printf("Error encountered: %s\n", err.Error())
 		}
-	} else {
-		fmt.Println(string(toWrite))
 	}
 }
 
@@ -44,8 +45,23 @@ func parseArgs() {
 	verbosePtr := cmdHttpc.Bool("v", false, libhttpc.HelpTextVerbose)
 	dataPtr := cmdHttpc.String("d", libhttpc.BlankString, libhttpc.HelpTextData)
 	filePtr := cmdHttpc.String("f", libhttpc.BlankString, libhttpc.HelpTextFile)
-	outputPtr := cmdHttpc.String("o", libhttpc.BlankString, libhttpc.HelpTextOutput)
+	dataBinaryPtr := cmdHttpc.String("data-binary", libhttpc.BlankString, libhttpc.HelpTextDataBinary)
+	var outputPtr flagList
+	cmdHttpc.Var(&outputPtr, "o", libhttpc.HelpTextOutput)
+	parallelMaxPtr := cmdHttpc.Int("parallel-max", 1, libhttpc.HelpTextParallelMax)
+	globOffPtr := cmdHttpc.Bool("globoff", false, libhttpc.HelpTextGlobOff)
+	remoteNamePtr := cmdHttpc.Bool("O", false, libhttpc.HelpTextRemoteName)
+	createDirsPtr := cmdHttpc.Bool("create-dirs", false, libhttpc.HelpTextCreateDirs)
+	noClobberPtr := cmdHttpc.Bool("no-clobber", false, libhttpc.HelpTextNoClobber)
+	harPtr := cmdHttpc.String("har", libhttpc.BlankString, libhttpc.HelpTextHAR)
+	exportPtr := cmdHttpc.String("export", libhttpc.BlankString, libhttpc.HelpTextExport)
+	jqPtr := cmdHttpc.String("jq", libhttpc.BlankString, libhttpc.HelpTextJq)
+	prettyPtr := cmdHttpc.String("pretty", "auto", libhttpc.HelpTextPretty)
+	colorPtr := cmdHttpc.String("color", "auto", libhttpc.HelpTextColor)
+	var formPtr flagList
+	cmdHttpc.Var(&formPtr, "F", libhttpc.HelpTextForm)
 	cmdHttpc.Var(&headerPtr, "h", libhttpc.HelpTextHeader)
+	common := addCommonFlags(cmdHttpc)
 
 	if len(os.Args) == 1 {
 		fmt.Println(libhttpc.HelpTextMain)
@@ -64,84 +80,137 @@ func parseArgs() {
 				fmt.Println(libhttpc.HelpTextGet)
 			} else if strings.ToLower(helpFor[0]) == "post" {
 				fmt.Println(libhttpc.HelpTextPost)
+			} else if strings.ToLower(helpFor[0]) == "run" {
+				fmt.Println(libhttpc.HelpTextRun)
+			} else if strings.ToLower(helpFor[0]) == "bench" {
+				fmt.Println(libhttpc.HelpTextBench)
+			} else if strings.ToLower(helpFor[0]) == "ws" {
+				fmt.Println(libhttpc.HelpTextWs)
+			} else if strings.ToLower(helpFor[0]) == "sse" {
+				fmt.Println(libhttpc.HelpTextSse)
+			} else if strings.ToLower(helpFor[0]) == "test" {
+				fmt.Println(libhttpc.HelpTextTest)
+			} else if strings.ToLower(helpFor[0]) == "from-curl" {
+				fmt.Println(libhttpc.HelpTextFromCurl)
+			} else if strings.ToLower(helpFor[0]) == "shell" {
+				fmt.Println(libhttpc.HelpTextShell)
 			} else {
 				fmt.Println(libhttpc.HelpTextMain)
 			}
 		}
 
+	case "run":
+		runCommand(os.Args[2:])
+
+	case "bench":
+		benchCommand(os.Args[2:])
+
+	case "test":
+		testCommand(os.Args[2:])
+
+	case "ws":
+		wsCommand(os.Args[2:])
+
+	case "sse":
+		sseCommand(os.Args[2:])
+
+	case "from-curl":
+		fromCurlCommand(os.Args[2:])
+
+	case "shell":
+		shellCommand(os.Args[2:])
+
 	default:
 		_ = cmdHttpc.Parse(os.Args[2:])
+		profile, transport, err := common.apply()
+		if err != nil {
+			fmt.Println(err)
+			exitStatus = 1
+			return
+		}
+		if *exportPtr != libhttpc.BlankString && *exportPtr != libhttpc.ExportGo && *exportPtr != libhttpc.ExportCurl {
+			fmt.Printf("Unknown export format '%s', expected go or curl\n", *exportPtr)
+			return
+		}
+		if *harPtr != libhttpc.BlankString {
+			defer startHAR(*harPtr)()
+		}
+		pretty, colour, err := terminalStyle(*prettyPtr, *colorPtr)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		output := &outputOptions{
+			remoteName: *remoteNamePtr,
+			createDirs: *createDirsPtr,
+			noClobber:  *noClobberPtr,
+			jq:         *jqPtr,
+			pretty:     pretty,
+			colour:     colour,
+		}
 		headers := map[string]string{}
 		url := ""
 		tail := cmdHttpc.Args()
 		method := os.Args[1]
 
 		for _, headerString := range headerPtr {
-			headerSet := strings.Split(headerString, ":")
-			headers[headerSet[0]] = headerSet[1]
+			headerSet := strings.SplitN(headerString, ":", 2)
+			if len(headerSet) == 2 {
+				headers[headerSet[0]] = headerSet[1]
+			}
 		}
+		profile.ApplyHeaders(headers)
 
 		if strings.ToLower(method) == "get" {
-			if len(tail) != 0 {
-				url = tail[len(tail)-1]
-				match, _ := regexp.MatchString("^http(s?)://", url)
-				if match == false {
-					url = "https://" + url
-				}
-			} else {
+			if len(tail) == 0 {
 				fmt.Println(libhttpc.HelpTextGet)
 				return
 			}
 
-			//res, getErr := libhttpc.Get(url, headers)
-			res, getErr := libhttpc.UDPGet(url, headers)
-
-			if getErr != nil {
-				writeOutput(outputPtr, []byte(getErr.Error()))
-				return
+			options := downloadOptions{
+				transport:   transport,
+				headers:     headers,
+				verbose:     *verbosePtr,
+				globOff:     *globOffPtr,
+				parallelMax: *parallelMaxPtr,
+				outputs:     outputPtr,
+				output:      *output,
+				export:      *exportPtr,
 			}
-			response, parsingErr := libhttpc.FromString(res)
-			if parsingErr != nil {
-				writeOutput(outputPtr, []byte(parsingErr.Error()))
+			downloads, err := planDownloads(tail, profile, options)
+			if err != nil {
+				printError(err)
+				exitStatus = 1
 				return
 			}
-
-			if response.StatusCode >= 300 && response.StatusCode <= 302 {
-				resString, redirectErr := libhttpc.HandleRedirects(response, res, headers, 0)
-				if redirectErr != nil {
-					writeOutput(outputPtr, []byte(redirectErr.Error()))
-					return
-				}
-				res = resString
-				responseAfterRedirect, parsingErr := libhttpc.FromString(res)
-				if parsingErr != nil {
-					writeOutput(outputPtr, []byte(parsingErr.Error()))
-					return
-				}
-				response = responseAfterRedirect
+			if runDownloads(downloads, options) > 0 {
+				exitStatus = 1
 			}
 
-			if *verbosePtr {
-				writeOutput(outputPtr, []byte(res))
+		} else if strings.ToLower(method) == "post" {
+			if len(formPtr) > 0 && (*dataPtr != libhttpc.BlankString || *dataBinaryPtr != libhttpc.BlankString || *filePtr != libhttpc.BlankString) {
+				fmt.Println(libhttpc.HelpTextPost)
 				return
 			}
+			requestBody, err := openRequestBody(*dataPtr, *dataBinaryPtr, *filePtr)
+			if err == nil && len(formPtr) > 0 {
+				var contentType string
+				requestBody, contentType, err = formBody(formPtr)
+				headers["Content-Type"] = contentType
+			}
+			if err != nil {
+				fmt.Println(err)
+				exitStatus = 1
+				return
+			}
+			defer requestBody.close()
 
-			writeOutput(outputPtr, []byte(response.Body))
-
-		} else if strings.ToLower(method) == "post" {
-			requestBody := []byte(*dataPtr)
-
-			if *filePtr != "" && len(requestBody) == 0 {
-				fileContent, err := ioutil.ReadFile(*filePtr)
-				if err != nil {
-					fmt.Println(err)
-					return
-				}
-				requestBody = fileContent
+			if len(outputPtr) > 0 {
+				output.path = outputPtr[0]
 			}
 
-			if len(tail) != 0 {
-				url = tail[len(tail)-1]
+			if len(tail) == 1 {
+				url = profile.ResolveURL(tail[0])
 				match, _ := regexp.MatchString("^http(s?)://", url)
 				if match == false {
 					url = "https://" + url
@@ -151,25 +220,44 @@ func parseArgs() {
 				return
 			}
 
-			//res, postErr := libhttpc.Post(url, headers, requestBody)
-			res, postErr := libhttpc.UDPPost(url, headers, requestBody)
-
-			if *verbosePtr {
-				writeOutput(outputPtr, []byte(res))
-				return
+			if *exportPtr != libhttpc.BlankString {
+				defer printExport(*exportPtr, libhttpc.ExportRequest{
+					Transport: transport,
+					Method:    "POST",
+					URL:       url,
+					Headers:   headers,
+					Body:      requestBody.content,
+					BodyFile:  requestBody.source,
+				})
 			}
 
+			res, postErr := libhttpc.SendStream(transport, "POST", url, headers, requestBody.reader, requestBody.length)
+
 			if postErr != nil {
-				writeOutput(outputPtr, []byte(postErr.Error()))
+				printError(postErr)
+				exitStatus = 1
 				return
 			}
 			response, parsingErr := libhttpc.FromString(res)
+			if parsingErr == nil && response == nil {
+				parsingErr = fmt.Errorf("Malformed response")
+			}
 			if parsingErr != nil {
-				writeOutput(outputPtr, []byte(parsingErr.Error()))
+				printError(parsingErr)
+				exitStatus = 1
 				return
 			}
 
-			writeOutput(outputPtr, []byte(response.Body))
+			toWrite, err := output.render(res, response, *verbosePtr)
+			if err != nil {
+				printError(err)
+				exitStatus = 1
+				return
+			}
+			if err := writeOutput(output, url, response, toWrite); err != nil {
+				printError(err)
+				exitStatus = 1
+			}
 		} else {
 			// error
 			fmt.Println(libhttpc.HelpTextMain)
@@ -179,4 +267,5 @@ func parseArgs() {
 
 func main() {
 	parseArgs()
+	os.Exit(exitStatus)
 }
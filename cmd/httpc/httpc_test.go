@@ -0,0 +1,24 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPostExitStatusOnOutputFailure(t *testing.T) {
+	url := startFileServer(t)
+	dir := t.TempDir()
+
+	if status := runHttpc(t, "post", "--transport", "tcp", "-d", "x", "-o", filepath.Join(dir, "x.txt"), url+"/x.txt"); status != 0 {
+		t.Fatalf("exit status %d for a written file, want 0", status)
+	}
+	cases := map[string][]string{
+		"missing directory": {"post", "--transport", "tcp", "-d", "x", "-o", filepath.Join(dir, "missing", "x.txt"), url + "/x.txt"},
+		"no file name":      {"post", "--transport", "tcp", "-d", "x", "-O", url + "/"},
+	}
+	for name, args := range cases {
+		if status := runHttpc(t, args...); status != 1 {
+			t.Errorf("%s: exit status %d, want 1", name, status)
+		}
+	}
+}
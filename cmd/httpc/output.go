@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const outputFileMode = 0644
+
+const maxClobberSuffix = 100
+
+// outputOptions decides where a response body goes: stdout, the -o path, or
+// with -O a name taken from the response.
+type outputOptions struct {
+	path       string
+	remoteName bool
+	createDirs bool
+	noClobber  bool
+	jq         string
+	pretty     bool
+	colour     bool
+}
+
+// render picks what to write for a response: the --jq value or the body.
+// Text bodies are transcoded to UTF-8 for a terminal and for --jq, and
+// formatted when pretty is set; anything else gets the bytes as received.
+// verbose keeps the status line and headers in front.
+func (output *outputOptions) render(raw string, response *libhttpc.Response, verbose bool) ([]byte, error) {
+	body := response.Body
+	contentType := response.Header("Content-Type")
+	toTerminal := !output.writesFile() && isTerminal(os.Stdout)
+	if libhttpc.IsTextContentType(contentType) && (toTerminal || output.jq != libhttpc.BlankString) {
+		if text, err := response.Text(); err == nil {
+			body = text
+		}
+	}
+	if output.jq != libhttpc.BlankString {
+		value, err := libhttpc.EvaluateJSONPath(body, output.jq)
+		if err != nil {
+			return nil, err
+		}
+		body = libhttpc.FormatJSONValue(value)
+		contentType = "application/json"
+		if _, isString := value.(string); isString {
+			contentType = "text/plain"
+		}
+	}
+	if output.pretty && !output.writesFile() {
+		body = libhttpc.FormatBody(contentType, body, output.colour)
+	}
+	if verbose {
+		return []byte(strings.TrimSuffix(raw, response.Body) + body), nil
+	}
+	return []byte(body), nil
+}
+
+// writeOutput prints toWrite or writes it to the file the options name.
+func writeOutput(output *outputOptions, requestURL string, response *libhttpc.Response, toWrite []byte) error {
+	target := output.path
+	if output.remoteName && target == libhttpc.BlankString {
+		name, err := remoteFileName(requestURL, response)
+		if err != nil {
+			return err
+		}
+		target = name
+	}
+
+	if target == libhttpc.BlankString {
+		console.printf("%s\n", toWrite)
+		return nil
+	}
+
+	written, err := writeFileAtomic(target, toWrite, output.createDirs, output.noClobber)
+	if err != nil {
+		return err
+	}
+	console.printf("Successfully written result to %s\n", written)
+	return nil
+}
+
+// terminalStyle resolves --pretty and --color. 'auto' formats and colours
+// only when stdout is a terminal, and colours not at all when NO_COLOR is set.
+func terminalStyle(pretty string, colour string) (bool, bool, error) {
+	terminal := isTerminal(os.Stdout)
+	resolve := func(flag string, value string, auto bool) (bool, error) {
+		switch value {
+		case "auto":
+			return auto, nil
+		case "always":
+			return true, nil
+		case "never":
+			return false, nil
+		}
+		return false, fmt.Errorf("Invalid --%s '%s', expected auto, always or never", flag, value)
+	}
+
+	prettyOn, err := resolve("pretty", pretty, terminal)
+	if err != nil {
+		return false, false, err
+	}
+	colourOn, err := resolve("color", colour, terminal && os.Getenv("NO_COLOR") == libhttpc.BlankString)
+	if err != nil {
+		return false, false, err
+	}
+	return prettyOn, prettyOn && colourOn, nil
+}
+
+func printError(err error) {
+	console.printf("Error encountered: %s\n", err.Error())
+}
+
+// printExport prints the --export snippet reproducing a request.
+func printExport(format string, request libhttpc.ExportRequest) {
+	snippet, err := libhttpc.Export(format, request)
+	if err != nil {
+		printError(err)
+		return
+	}
+	console.printf("%s\n", strings.TrimSuffix(snippet, "\n"))
+}
+
+// remoteFileName prefers the Content-Disposition filename and falls back to
+// the last segment of the URL path. Directories are always stripped.
+func remoteFileName(requestURL string, response *libhttpc.Response) (string, error) {
+	if response != nil {
+		disposition := response.Header("Content-Disposition")
+		if _, params, err := mime.ParseMediaType(disposition); err == nil {
+			if name := filepath.Base(params["filename"]); params["filename"] != "" && name != "." && name != "/" {
+				return name, nil
+			}
+		}
+	}
+
+	parsedURL, err := url.Parse(requestURL)
+	if err != nil {
+		return libhttpc.BlankString, err
+	}
+	name := path.Base(parsedURL.Path)
+	if name == "." || name == "/" || name == libhttpc.BlankString {
+		return libhttpc.BlankString, fmt.Errorf("Cannot derive a file name from %s", requestURL)
+	}
+	return name, nil
+}
+
+// writeFileAtomic writes to a temporary file next to target and renames it
+// into place, so a failed write never leaves a partial file behind. With
+// noClobber an existing target is kept and a numbered name (target.1, ...)
+// is used instead. It returns the path actually written.
+func writeFileAtomic(target string, content []byte, createDirs bool, noClobber bool) (string, error) {
+	dir := filepath.Dir(target)
+	if createDirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return libhttpc.BlankString, err
+		}
+	}
+
+	temp, err := ioutil.TempFile(dir, "."+filepath.Base(target)+".tmp-")
+	if err != nil {
+		return libhttpc.BlankString, err
+	}
+	tempName := temp.Name()
+	defer os.Remove(tempName)
+
+	_, err = temp.Write(content)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempName, outputFileMode)
+	}
+	if err != nil {
+		return libhttpc.BlankString, err
+	}
+
+	if !noClobber {
+		return target, os.Rename(tempName, target)
+	}
+
+	// a hard link fails if the name is taken, which makes the check and the
+	// write one atomic step
+	candidate := target
+	for suffix := 1; suffix <= maxClobberSuffix; suffix++ {
+		err = os.Link(tempName, candidate)
+		if err == nil {
+			return candidate, nil
+		}
+		if !os.IsExist(err) {
+			return libhttpc.BlankString, err
+		}
+		candidate = fmt.Sprintf("%s.%d", target, suffix)
+	}
+	return libhttpc.BlankString, fmt.Errorf("Refusing to overwrite %s", target)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxVariableDepth = 10
+
+type runResult struct {
+	request  libhttpc.HTTPFileRequest
+	method   string
+	url      string
+	raw      string
+	response *libhttpc.Response
+	elapsed  time.Duration
+	err      error
+}
+
+func (result *runResult) passed() bool {
+	return result.err == nil && result.response != nil && result.response.StatusCode < 400
+}
+
+type httpFileRunner struct {
+	file      *libhttpc.HTTPFile
+	profile   *libhttpc.Profile
+	transport string
+	results   []runResult
+	done      []chan bool
+	indexOf   map[string]int
+}
+
+func runCommand(args []string) {
+	cmdRun := flag.NewFlagSet("run", flag.ExitOnError)
+	verbosePtr := cmdRun.Bool("v", false, libhttpc.HelpTextVerbose)
+	parallelPtr := cmdRun.Int("parallel", 1, libhttpc.HelpTextParallel)
+	common := addCommonFlags(cmdRun)
+	harPtr := cmdRun.String("har", libhttpc.BlankString, libhttpc.HelpTextHAR)
+	_ = cmdRun.Parse(args)
+
+	if cmdRun.NArg() != 1 {
+		fmt.Println(libhttpc.HelpTextRun)
+		return
+	}
+
+	file, err := libhttpc.ReadHTTPFile(cmdRun.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+
+	profile, transport, err := common.apply()
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+
+	runner := newHTTPFileRunner(file, profile, transport)
+	if *harPtr != libhttpc.BlankString {
+		writeHAR := startHAR(*harPtr)
+		runner.run(*parallelPtr)
+		writeHAR()
+	} else {
+		runner.run(*parallelPtr)
+	}
+
+	failed := 0
+	for i := range runner.results {
+		result := &runner.results[i]
+		if result.passed() {
+			fmt.Printf("[PASS] %s %s %s -> %d (%s)\n", result.request.Name, result.method, result.url,
+				result.response.StatusCode, result.elapsed.Round(time.Millisecond))
+		} else {
+			failed++
+			if result.err != nil {
+				fmt.Printf("[FAIL] %s %s %s: %s\n", result.request.Name, result.method, result.url, result.err.Error())
+			} else {
+				fmt.Printf("[FAIL] %s %s %s -> %d (%s)\n", result.request.Name, result.method, result.url,
+					result.response.StatusCode, result.elapsed.Round(time.Millisecond))
+			}
+		}
+		if *verbosePtr && result.raw != libhttpc.BlankString {
+			fmt.Println(result.raw)
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed, %d total\n", len(runner.results)-failed, failed, len(runner.results))
+	if failed > 0 {
+		exitStatus = 1
+	}
+}
+
+func newHTTPFileRunner(file *libhttpc.HTTPFile, profile *libhttpc.Profile, transport string) *httpFileRunner {
+	runner := httpFileRunner{
+		file:      file,
+		profile:   profile,
+		transport: transport,
+		results:   make([]runResult, len(file.Requests)),
+		done:      make([]chan bool, len(file.Requests)),
+		indexOf:   map[string]int{},
+	}
+	for i, request := range file.Requests {
+		runner.done[i] = make(chan bool)
+		runner.indexOf[request.Name] = i
+	}
+	return &runner
+}
+
+// run executes the requests with up to `parallel` in flight. Requests are
+// dispatched in file order and a request referencing an earlier response
+// waits for it, so references keep working in parallel mode.
+func (runner *httpFileRunner) run(parallel int) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < parallel; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				runner.execute(index)
+				close(runner.done[index])
+			}
+		}()
+	}
+
+	for index := range runner.file.Requests {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (runner *httpFileRunner) execute(index int) {
+	request := runner.file.Requests[index]
+	result := &runner.results[index]
+	result.request = request
+	result.method = request.Method
+	result.url = request.URL
+
+	lookup := func(expression string) (string, error) {
+		return runner.lookup(index, expression, 0)
+	}
+
+	url, err := libhttpc.SubstituteVariables(request.URL, lookup)
+	if err != nil {
+		result.err = err
+		return
+	}
+	url = runner.profile.ResolveURL(url)
+	result.url = url
+
+	headers := libhttpc.RequestHeader{}
+	for _, headerLine := range request.Headers {
+		header, err := libhttpc.SubstituteVariables(headerLine, lookup)
+		if err != nil {
+			result.err = err
+			return
+		}
+		headerSet := strings.SplitN(header, ":", 2)
+		headers[strings.TrimSpace(headerSet[0])] = strings.TrimSpace(headerSet[1])
+	}
+	runner.profile.ApplyHeaders(headers)
+
+	body, err := libhttpc.SubstituteVariables(request.Body, lookup)
+	if err != nil {
+		result.err = err
+		return
+	}
+
+	start := time.Now()
+	raw, err := libhttpc.Send(runner.transport, request.Method, url, headers, []byte(body))
+	result.elapsed = time.Since(start)
+	result.raw = raw
+	if err != nil {
+		result.err = err
+		return
+	}
+
+	response, err := libhttpc.FromString(raw)
+	if err != nil {
+		result.err = err
+		return
+	}
+	if response == nil {
+		result.err = fmt.Errorf("Malformed response")
+		return
+	}
+	result.response = response
+}
+
+func (runner *httpFileRunner) lookup(index int, expression string, depth int) (string, error) {
+	if depth > maxVariableDepth {
+		return libhttpc.BlankString, fmt.Errorf("Variable '%s' is nested too deeply", expression)
+	}
+
+	if strings.HasPrefix(expression, "$processEnv ") {
+		return os.Getenv(strings.TrimSpace(strings.TrimPrefix(expression, "$processEnv "))), nil
+	}
+
+	if value, ok := runner.file.Variables[expression]; ok {
+		return libhttpc.SubstituteVariables(value, func(inner string) (string, error) {
+			return runner.lookup(index, inner, depth+1)
+		})
+	}
+
+	nameSplit := strings.SplitN(expression, ".", 2)
+	if referenced, ok := runner.indexOf[nameSplit[0]]; ok && len(nameSplit) == 2 {
+		if referenced >= index {
+			return libhttpc.BlankString, fmt.Errorf("'%s' refers to a request that has not run yet", expression)
+		}
+		<-runner.done[referenced]
+		return libhttpc.ResolveResponseReference(runner.results[referenced].response, nameSplit[1])
+	}
+
+	return libhttpc.BlankString, fmt.Errorf("Undefined variable '%s'", expression)
+}
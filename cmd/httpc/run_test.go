@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunExitStatus(t *testing.T) {
+	url := startFileServer(t)
+	dir := t.TempDir()
+	passing := filepath.Join(dir, "passing.http")
+	failing := filepath.Join(dir, "failing.http")
+	if err := ioutil.WriteFile(passing, []byte("GET "+url+"/a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(failing, []byte("GET "+url+"/a\n###\nGET {{undefined}}/b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		args []string
+		want int
+	}{
+		"passing":      {[]string{"run", "--transport", "tcp", passing}, 0},
+		"failing":      {[]string{"run", "--transport", "tcp", failing}, 1},
+		"missing file": {[]string{"run", "--transport", "tcp", filepath.Join(dir, "missing.http")}, 1},
+	}
+	for name, c := range cases {
+		if status := runHttpc(t, c.args...); status != c.want {
+			t.Errorf("%s: exit status %d, want %d", name, status, c.want)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const shellPrompt = "httpc> "
+
+// shellEntry is one request of the session history with its outcome.
+type shellEntry struct {
+	method   string
+	url      string
+	headers  libhttpc.RequestHeader
+	body     string
+	raw      string
+	response *libhttpc.Response
+	elapsed  time.Duration
+	err      error
+}
+
+// shellSession is the state kept between the commands of httpc shell.
+type shellSession struct {
+	baseURL   string
+	headers   libhttpc.RequestHeader
+	jar       *libhttpc.CookieJar
+	history   []*shellEntry
+	transport string
+	verbose   bool
+	output    outputOptions
+}
+
+// shellCommand reads commands from stdin until 'exit' or end of input.
+func shellCommand(args []string) {
+	cmdShell := flag.NewFlagSet("shell", flag.ExitOnError)
+	var headerPtr flagList
+	cmdShell.Var(&headerPtr, "h", libhttpc.HelpTextHeader)
+	common := addCommonFlags(cmdShell)
+	_ = cmdShell.Parse(args)
+
+	if cmdShell.NArg() > 1 {
+		fmt.Println(libhttpc.HelpTextShell)
+		return
+	}
+
+	profile, transport, err := common.apply()
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+	pretty, colour, _ := terminalStyle("auto", "auto")
+
+	session := &shellSession{
+		baseURL:   profile.BaseURL,
+		headers:   libhttpc.RequestHeader{},
+		jar:       libhttpc.NewCookieJar(),
+		transport: transport,
+		output:    outputOptions{pretty: pretty, colour: colour},
+	}
+	if cmdShell.NArg() == 1 {
+		session.baseURL = cmdShell.Arg(0)
+	}
+	profile.ApplyHeaders(session.headers)
+	for _, headerString := range headerPtr {
+		session.setHeader(headerString)
+	}
+
+	interactive := isTerminal(os.Stdin)
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		if interactive {
+			fmt.Print(shellPrompt)
+		}
+		line, err := reader.ReadString('\n')
+		if strings.TrimSpace(line) != libhttpc.BlankString {
+			if !session.execute(strings.TrimSpace(line)) {
+				return
+			}
+		}
+		if err != nil {
+			if interactive {
+				fmt.Println()
+			}
+			return
+		}
+	}
+}
+
+// execute runs one shell command and reports whether the session goes on.
+func (session *shellSession) execute(line string) bool {
+	command, rest := line, libhttpc.BlankString
+	if space := strings.IndexAny(line, " \t"); space != -1 {
+		command, rest = line[:space], strings.TrimSpace(line[space+1:])
+	}
+
+	switch strings.ToLower(command) {
+	case "exit", "quit":
+		return false
+	case "help", "?":
+		fmt.Println(libhttpc.HelpTextShellCommands)
+	case "base":
+		if rest != libhttpc.BlankString {
+			session.baseURL = rest
+		}
+		fmt.Printf("base %s\n", session.baseURL)
+	case "header":
+		if rest == libhttpc.BlankString || !session.setHeader(rest) {
+			fmt.Println("usage: header Name: value")
+		}
+	case "unheader":
+		for key := range session.headers {
+			if strings.EqualFold(key, rest) {
+				delete(session.headers, key)
+			}
+		}
+	case "headers":
+		keys := make([]string, 0, len(session.headers))
+		for key := range session.headers {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("%s: %s\n", key, strings.TrimSpace(session.headers[key]))
+		}
+	case "cookies":
+		if rest == "clear" {
+			session.jar.Clear()
+			return true
+		}
+		for _, cookie := range session.jar.Cookies() {
+			fmt.Printf("%s=%s (domain %s, path %s)\n", cookie.Name, cookie.Value, cookie.Domain, cookie.Path)
+		}
+	case "verbose":
+		session.verbose = rest != "off"
+		fmt.Printf("verbose %t\n", session.verbose)
+	case "transport":
+		if rest == libhttpc.TransportTCP || rest == libhttpc.TransportUDP {
+			session.transport = rest
+		}
+		fmt.Printf("transport %s\n", session.transport)
+	case "history":
+		for i, entry := range session.history {
+			fmt.Printf("%3d  %s\n", i+1, entry.summary())
+		}
+	case "show":
+		if entry := session.entry(rest); entry != nil {
+			session.print(entry)
+		}
+	case "rerun", "again":
+		if entry := session.entry(rest); entry != nil {
+			session.send(entry.method, entry.url, entry.body)
+		}
+	case "save":
+		session.save(rest)
+	default:
+		if !isShellMethod(command) {
+			fmt.Printf("Unknown command '%s', type 'help' for the list of commands\n", command)
+			return true
+		}
+		target, body := rest, libhttpc.BlankString
+		if space := strings.IndexAny(rest, " \t"); space != -1 {
+			target, body = rest[:space], strings.TrimSpace(rest[space+1:])
+		}
+		session.send(strings.ToUpper(command), session.resolve(target), body)
+	}
+	return true
+}
+
+// send makes a request with the session headers and cookies, prints the
+// response and appends it to the history.
+func (session *shellSession) send(method string, url string, body string) {
+	headers := libhttpc.RequestHeader{}
+	for key, value := range session.headers {
+		headers[key] = value
+	}
+	if cookies := session.jar.Header(url); cookies != libhttpc.BlankString && headers["Cookie"] == libhttpc.BlankString {
+		headers["Cookie"] = cookies
+	}
+	if body != libhttpc.BlankString && headers["Content-Type"] == libhttpc.BlankString {
+		if trimmed := strings.TrimSpace(body); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			headers["Content-Type"] = "application/json"
+		}
+	}
+
+	// middlewares add headers to the map they are given, such as tokens and
+	// signatures, which must not end up in a saved .http file
+	entry := &shellEntry{method: method, url: url, headers: libhttpc.RequestHeader{}, body: body}
+	for key, value := range headers {
+		entry.headers[key] = value
+	}
+	started := time.Now()
+	entry.raw, entry.err = libhttpc.Send(session.transport, method, url, headers, []byte(body))
+	entry.elapsed = time.Since(started)
+	if entry.err == nil {
+		entry.response, entry.err = libhttpc.FromString(entry.raw)
+		if entry.err == nil && entry.response == nil {
+			entry.err = fmt.Errorf("Malformed response")
+		}
+	}
+	if entry.err == nil {
+		session.jar.Update(url, entry.response)
+	}
+
+	session.history = append(session.history, entry)
+	session.print(entry)
+}
+
+func (session *shellSession) print(entry *shellEntry) {
+	if entry.err != nil {
+		fmt.Printf("Error encountered: %s\n", entry.err.Error())
+		return
+	}
+	toWrite, err := session.output.render(entry.raw, entry.response, session.verbose)
+	if err != nil {
+		fmt.Printf("Error encountered: %s\n", err.Error())
+		return
+	}
+	if !session.verbose {
+		fmt.Printf("%s %d (%s)\n", entry.response.Protocol, entry.response.StatusCode, entry.elapsed.Round(time.Millisecond))
+	}
+	fmt.Println(string(toWrite))
+}
+
+// entry finds a history entry by number; no number means the last one.
+func (session *shellSession) entry(number string) *shellEntry {
+	if len(session.history) == 0 {
+		fmt.Println("History is empty")
+		return nil
+	}
+	if number == libhttpc.BlankString {
+		return session.history[len(session.history)-1]
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(number, "#"))
+	if err != nil || index < 1 || index > len(session.history) {
+		fmt.Printf("No history entry '%s'\n", number)
+		return nil
+	}
+	return session.history[index-1]
+}
+
+// save writes the history, or the listed entries, as a .http file.
+func (session *shellSession) save(arguments string) {
+	fields := strings.Fields(arguments)
+	if len(fields) == 0 {
+		fmt.Println("usage: save file.http [entry...]")
+		return
+	}
+
+	entries := session.history
+	if len(fields) > 1 {
+		entries = nil
+		for _, number := range fields[1:] {
+			entry := session.entry(number)
+			if entry == nil {
+				return
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	file := &libhttpc.HTTPFile{}
+	for i, entry := range entries {
+		request := libhttpc.HTTPFileRequest{
+			Name:   fmt.Sprintf("request%d", i+1),
+			Method: entry.method,
+			URL:    entry.url,
+			Body:   entry.body,
+		}
+		keys := make([]string, 0, len(entry.headers))
+		for key := range entry.headers {
+			// cookies come from the jar and Content-Length is recomputed
+			if !strings.EqualFold(key, "Cookie") && !strings.EqualFold(key, "Content-Length") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			request.Headers = append(request.Headers, key+": "+strings.TrimSpace(entry.headers[key]))
+		}
+		file.Requests = append(file.Requests, request)
+	}
+
+	if err := libhttpc.WriteHTTPFile(fields[0], file); err != nil {
+		fmt.Printf("Error encountered: %s\n", err.Error())
+		return
+	}
+	fmt.Printf("Saved %d requests to %s\n", len(entries), fields[0])
+}
+
+func (session *shellSession) setHeader(header string) bool {
+	keyValue := strings.SplitN(header, ":", 2)
+	if len(keyValue) != 2 || strings.TrimSpace(keyValue[0]) == libhttpc.BlankString {
+		return false
+	}
+	session.headers[strings.TrimSpace(keyValue[0])] = " " + strings.TrimSpace(keyValue[1])
+	return true
+}
+
+func (session *shellSession) resolve(target string) string {
+	url := (&libhttpc.Profile{BaseURL: session.baseURL}).ResolveURL(target)
+	if match, _ := regexp.MatchString("^http(s?)://", url); !match {
+		url = "https://" + url
+	}
+	return url
+}
+
+func (entry *shellEntry) summary() string {
+	outcome := "error: " + fmt.Sprint(entry.err)
+	if entry.err == nil {
+		outcome = strconv.Itoa(entry.response.StatusCode)
+	}
+	return fmt.Sprintf("%s %s -> %s (%s)", entry.method, entry.url, outcome, entry.elapsed.Round(time.Millisecond))
+}
+
+func isShellMethod(command string) bool {
+	switch strings.ToLower(command) {
+	case "get", "post", "put", "patch", "delete", "head", "options":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"strings"
+)
+
+// sseCommand prints the events of a text/event-stream as they arrive.
+func sseCommand(args []string) {
+	cmdSse := flag.NewFlagSet("sse", flag.ExitOnError)
+
+	var headerPtr flagList
+	verbosePtr := cmdSse.Bool("v", false, libhttpc.HelpTextSseVerbose)
+	jsonPtr := cmdSse.Bool("json", false, libhttpc.HelpTextSseJSON)
+	lastEventIDPtr := cmdSse.String("last-event-id", libhttpc.BlankString, libhttpc.HelpTextSseLastEventID)
+	countPtr := cmdSse.Int("n", 0, libhttpc.HelpTextSseCount)
+	cmdSse.Var(&headerPtr, "h", libhttpc.HelpTextHeader)
+	common := addHandshakeFlags(cmdSse)
+	_ = cmdSse.Parse(args)
+
+	if cmdSse.NArg() != 1 {
+		fmt.Println(libhttpc.HelpTextSse)
+		return
+	}
+
+	profile, _, err := common.apply()
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+
+	headers := libhttpc.RequestHeader{}
+	for _, headerString := range headerPtr {
+		headerSet := strings.SplitN(headerString, ":", 2)
+		if len(headerSet) == 2 {
+			headers[headerSet[0]] = headerSet[1]
+		}
+	}
+	profile.ApplyHeaders(headers)
+
+	stream, err := libhttpc.OpenEventStream(profile.ResolveURL(cmdSse.Arg(0)), headers, *lastEventIDPtr)
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+	defer stream.Close()
+
+	for received := 0; *countPtr <= 0 || received < *countPtr; received++ {
+		event, err := stream.Next()
+		if err != nil {
+			fmt.Println(err)
+			exitStatus = 1
+			return
+		}
+
+		switch {
+		case *jsonPtr:
+			encoded, _ := json.Marshal(map[string]string{"id": event.ID, "event": event.Event, "data": event.Data})
+			fmt.Println(string(encoded))
+		case *verbosePtr:
+			if event.ID != libhttpc.BlankString {
+				fmt.Printf("id: %s\n", event.ID)
+			}
+			fmt.Printf("event: %s\n", event.Event)
+			for _, line := range strings.Split(event.Data, "\n") {
+				fmt.Printf("data: %s\n", line)
+			}
+			fmt.Println()
+		default:
+			fmt.Println(event.Data)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// testCommand runs the cases of a YAML spec, prints a summary and writes the
+// results as JUnit XML.
+func testCommand(args []string) {
+	cmdTest := flag.NewFlagSet("test", flag.ExitOnError)
+	junitPtr := cmdTest.String("junit", "junit.xml", libhttpc.HelpTextJUnit)
+	common := addCommonFlags(cmdTest)
+	_ = cmdTest.Parse(args)
+
+	if cmdTest.NArg() != 1 {
+		fmt.Println(libhttpc.HelpTextTest)
+		return
+	}
+
+	spec, err := libhttpc.ReadTestSpec(cmdTest.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+
+	profile, transport, err := common.apply()
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+	if spec.Transport != libhttpc.BlankString && !flagWasSet(cmdTest, "transport") {
+		transport = spec.Transport
+	}
+
+	suiteName := spec.Name
+	if suiteName == libhttpc.BlankString {
+		suiteName = strings.TrimSuffix(filepath.Base(cmdTest.Arg(0)), filepath.Ext(cmdTest.Arg(0)))
+	}
+
+	started := time.Now()
+	results := []libhttpc.TestResult{}
+	failed := 0
+	for _, testCase := range spec.Cases {
+		headers := libhttpc.RequestHeader{}
+		for key, value := range spec.Headers {
+			headers[key] = value
+		}
+		for key, value := range testCase.Request.Headers {
+			headers[key] = value
+		}
+		profile.ApplyHeaders(headers)
+
+		result := libhttpc.RunTestCase(testCase, transport, testURL(spec, profile, testCase.Request.URL), headers)
+		results = append(results, result)
+
+		elapsed := result.Duration.Round(time.Millisecond)
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("[ERROR] %s (%s): %s\n", result.Name, elapsed, result.Err.Error())
+		case len(result.Failures) > 0:
+			failed++
+			fmt.Printf("[FAIL] %s (%s)\n", result.Name, elapsed)
+			for _, failure := range result.Failures {
+				fmt.Printf("    %s\n", failure)
+			}
+		default:
+			fmt.Printf("[PASS] %s (%s)\n", result.Name, elapsed)
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed, %d total in %s\n",
+		len(results)-failed, failed, len(results), time.Since(started).Round(time.Millisecond))
+	if failed > 0 {
+		exitStatus = 1
+	}
+
+	if *junitPtr == libhttpc.BlankString {
+		return
+	}
+	report, err := libhttpc.JUnitReport(suiteName, started, results)
+	if err == nil {
+		err = ioutil.WriteFile(*junitPtr, report, outputFileMode)
+	}
+	if err != nil {
+		fmt.Printf("Error encountered: %s\n", err.Error())
+		exitStatus = 1
+	}
+}
+
+// testURL resolves a case URL against the spec's base_url, then the profile.
+func testURL(spec *libhttpc.TestSpec, profile *libhttpc.Profile, url string) string {
+	if spec.BaseURL != libhttpc.BlankString {
+		url = (&libhttpc.Profile{BaseURL: spec.BaseURL}).ResolveURL(url)
+	}
+	url = profile.ResolveURL(url)
+	if match, _ := regexp.MatchString("^http(s?)://", url); !match {
+		url = "https://" + url
+	}
+	return url
+}
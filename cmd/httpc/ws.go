@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"httpc/pkg/libhttpc"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const wsCloseWait = 2 * time.Second
+
+// wsCommand bridges stdin and stdout to a websocket: every stdin line is
+// sent as a message and every received message is printed on its own line.
+func wsCommand(args []string) {
+	cmdWs := flag.NewFlagSet("ws", flag.ExitOnError)
+
+	var headerPtr flagList
+	verbosePtr := cmdWs.Bool("v", false, libhttpc.HelpTextWsVerbose)
+	binaryPtr := cmdWs.Bool("binary", false, libhttpc.HelpTextWsBinary)
+	pingPtr := cmdWs.Duration("ping", 0, libhttpc.HelpTextWsPing)
+	cmdWs.Var(&headerPtr, "h", libhttpc.HelpTextHeader)
+	common := addHandshakeFlags(cmdWs)
+	_ = cmdWs.Parse(args)
+
+	if cmdWs.NArg() != 1 {
+		fmt.Println(libhttpc.HelpTextWs)
+		return
+	}
+
+	profile, _, err := common.apply()
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+
+	headers := libhttpc.RequestHeader{}
+	for _, headerString := range headerPtr {
+		headerSet := strings.SplitN(headerString, ":", 2)
+		if len(headerSet) == 2 {
+			headers[headerSet[0]] = headerSet[1]
+		}
+	}
+	profile.ApplyHeaders(headers)
+
+	ws, err := libhttpc.DialWebSocket(profile.ResolveURL(cmdWs.Arg(0)), headers)
+	if err != nil {
+		fmt.Println(err)
+		exitStatus = 1
+		return
+	}
+	logWs(*verbosePtr, "connected to %s", cmdWs.Arg(0))
+
+	received := make(chan error, 1)
+	go func() {
+		received <- readWebSocket(ws, *verbosePtr)
+	}()
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- writeWebSocket(ws, *binaryPtr)
+	}()
+
+	var keepAlive <-chan time.Time
+	if *pingPtr > 0 {
+		ticker := time.NewTicker(*pingPtr)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-received:
+			reportWsEnd(err, *verbosePtr)
+			return
+		case err := <-sent:
+			sent = nil
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			_ = ws.Close(libhttpc.CloseNormal, libhttpc.BlankString)
+			select {
+			case err := <-received:
+				reportWsEnd(err, *verbosePtr)
+			case <-time.After(wsCloseWait):
+				logWs(*verbosePtr, "no close reply, dropping the connection")
+				ws.Shutdown()
+			}
+			return
+		case <-keepAlive:
+			logWs(*verbosePtr, "ping")
+			if err := ws.Ping(nil); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+}
+
+func readWebSocket(ws *libhttpc.WebSocket, verbose bool) error {
+	for {
+		message, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		switch message.Opcode {
+		case libhttpc.OpPong:
+			logWs(verbose, "pong")
+		case libhttpc.OpBinary:
+			os.Stdout.Write(message.Data)
+			fmt.Println()
+		default:
+			fmt.Println(string(message.Data))
+		}
+	}
+}
+
+func writeWebSocket(ws *libhttpc.WebSocket, binary bool) error {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			var writeErr error
+			if binary {
+				writeErr = ws.WriteBinary([]byte(line))
+			} else {
+				writeErr = ws.WriteText(line)
+			}
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func reportWsEnd(err error, verbose bool) {
+	var closeErr *libhttpc.WebSocketCloseError
+	if errors.As(err, &closeErr) {
+		logWs(verbose, "closed with code %d %s", closeErr.Code, closeErr.Reason)
+		if closeErr.Code != libhttpc.CloseNormal && closeErr.Code != libhttpc.CloseNoStatus {
+			exitStatus = 1
+		}
+		return
+	}
+	if err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, err)
+		exitStatus = 1
+	}
+}
+
+func logWs(verbose bool, format string, args ...interface{}) {
+	if verbose {
+		fmt.Fprintf(os.Stderr, "* "+format+"\n", args...)
+	}
+}
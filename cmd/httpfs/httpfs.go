@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"httpc/pkg/libhttpserver"
+	"httpc/pkg/rudp"
 	"io/ioutil"
 	"log"
 	"os"
@@ -119,12 +120,29 @@ func parseArgs() {
 	verbosePtr := flag.Bool("v", false, libhttpserver.HelpTextVerbose)
 	dirPtr := flag.String("d", currDir, libhttpserver.HelpTextDir)
 	portPtr := flag.String("p", "8080", libhttpserver.HelpTextPort)
+	windowPtr := flag.Int("window", 0, libhttpserver.HelpTextWindow)
+	congestionPtr := flag.String("congestion", rudp.CongestionReno, libhttpserver.HelpTextCongestion)
+	cwndTracePtr := flag.String("cwnd-trace", "", libhttpserver.HelpTextCwndTrace)
 
 	flag.Parse()
 	fmt.Printf("Server listening on port: %s\nDirectory Served: %s\nVerbose Logging:%t\n\n", *portPtr, *dirPtr, *verbosePtr)
 
 	//PORT := ":" + *portPtr
 
+	libhttpserver.SetWindow(*windowPtr)
+	congestion, err := rudp.ParseCongestion(*congestionPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	libhttpserver.SetCongestion(congestion)
+	if *cwndTracePtr != "" {
+		traceFile, err := os.Create(*cwndTracePtr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer traceFile.Close()
+		libhttpserver.SetCwndTrace(rudp.NewTrace(traceFile))
+	}
 	libhttpserver.RegisterHandler("POST", "/", getHandler)
 	libhttpserver.RegisterHandler("GET", "/", getHandler)
 	//libhttpserver.StartServer(PORT, *dirPtr, *verbosePtr)
@@ -0,0 +1,239 @@
+package libhttpc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+type BenchOptions struct {
+	Method      string
+	URL         string
+	Transport   string
+	Headers     RequestHeader
+	Body        []byte
+	Requests    int
+	Concurrency int
+	Rate        float64
+	Duration    time.Duration
+}
+
+type LatencySummary struct {
+	Min  float64 `json:"min_ms"`
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+type HistogramBucket struct {
+	UpperBound float64 `json:"le_ms"`
+	Count      int     `json:"count"`
+}
+
+type BenchReport struct {
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	Transport   string            `json:"transport"`
+	Concurrency int               `json:"concurrency"`
+	Requests    int               `json:"requests"`
+	Succeeded   int               `json:"succeeded"`
+	Failed      int               `json:"failed"`
+	Elapsed     float64           `json:"elapsed_s"`
+	Throughput  float64           `json:"throughput_rps"`
+	StatusCodes map[int]int       `json:"status_codes"`
+	Errors      map[string]int    `json:"errors"`
+	Latency     LatencySummary    `json:"latency"`
+	Histogram   []HistogramBucket `json:"histogram"`
+}
+
+const histogramBuckets = 10
+
+type benchSample struct {
+	latency    time.Duration
+	statusCode int
+	err        error
+}
+
+// RunBenchmark drives Send with a fixed number of workers until either the
+// request count or the duration is exhausted, optionally capped at Rate
+// requests per second.
+func RunBenchmark(options BenchOptions) (*BenchReport, error) {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	if options.Requests <= 0 && options.Duration <= 0 {
+		return nil, errors.New("Either a request count or a duration is required")
+	}
+	// the ticker needs an interval of at least 1ns that fits a Duration
+	var interval time.Duration
+	if options.Rate > 0 {
+		nanoseconds := float64(time.Second) / options.Rate
+		if nanoseconds < 1 || nanoseconds > math.MaxInt64 {
+			return nil, fmt.Errorf("Rate %g is out of range, expected between 1e-9 and 1e9 requests per second", options.Rate)
+		}
+		interval = time.Duration(nanoseconds)
+	}
+
+	jobs := make(chan bool)
+	samples := make(chan benchSample, options.Concurrency)
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < options.Concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				samples <- benchOnce(options)
+			}
+		}()
+	}
+
+	start := time.Now()
+	go func() {
+		var throttle <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			throttle = ticker.C
+		}
+		for sent := 0; options.Requests <= 0 || sent < options.Requests; sent++ {
+			if options.Duration > 0 && time.Since(start) >= options.Duration {
+				break
+			}
+			if throttle != nil {
+				<-throttle
+			}
+			jobs <- true
+		}
+		close(jobs)
+		wg.Wait()
+		close(samples)
+	}()
+
+	var collected []benchSample
+	for sample := range samples {
+		collected = append(collected, sample)
+	}
+
+	return summarizeBenchmark(options, collected, time.Since(start)), nil
+}
+
+func benchOnce(options BenchOptions) benchSample {
+	headers := RequestHeader{}
+	for key, value := range options.Headers {
+		headers[key] = value
+	}
+
+	start := time.Now()
+	raw, err := Send(options.Transport, options.Method, options.URL, headers, options.Body)
+	sample := benchSample{latency: time.Since(start), err: err}
+	if err != nil {
+		return sample
+	}
+
+	response, err := FromString(raw)
+	if err != nil || response == nil {
+		sample.err = errors.New("malformed response")
+		return sample
+	}
+	sample.statusCode = response.StatusCode
+	return sample
+}
+
+func summarizeBenchmark(options BenchOptions, samples []benchSample, elapsed time.Duration) *BenchReport {
+	report := BenchReport{
+		Method:      options.Method,
+		URL:         options.URL,
+		Transport:   options.Transport,
+		Concurrency: options.Concurrency,
+		Requests:    len(samples),
+		Elapsed:     elapsed.Seconds(),
+		StatusCodes: map[int]int{},
+		Errors:      map[string]int{},
+	}
+
+	latencies := make([]float64, 0, len(samples))
+	total := 0.0
+	for _, sample := range samples {
+		if sample.err != nil {
+			report.Failed++
+			report.Errors[classifyBenchError(sample.err)]++
+			continue
+		}
+		report.StatusCodes[sample.statusCode]++
+		if sample.statusCode >= 400 {
+			report.Failed++
+			report.Errors[fmt.Sprintf("status %d", sample.statusCode)]++
+		} else {
+			report.Succeeded++
+		}
+		latency := float64(sample.latency) / float64(time.Millisecond)
+		latencies = append(latencies, latency)
+		total += latency
+	}
+
+	if elapsed > 0 {
+		report.Throughput = float64(len(samples)) / elapsed.Seconds()
+	}
+	if len(latencies) == 0 {
+		return &report
+	}
+
+	sort.Float64s(latencies)
+	report.Latency = LatencySummary{
+		Min:  latencies[0],
+		Mean: total / float64(len(latencies)),
+		P50:  percentile(latencies, 50),
+		P90:  percentile(latencies, 90),
+		P99:  percentile(latencies, 99),
+		Max:  latencies[len(latencies)-1],
+	}
+	report.Histogram = histogram(latencies)
+	return &report
+}
+
+// percentile uses the nearest-rank method on sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func histogram(sorted []float64) []HistogramBucket {
+	fastest, slowest := sorted[0], sorted[len(sorted)-1]
+	step := (slowest - fastest) / histogramBuckets
+	buckets := make([]HistogramBucket, histogramBuckets)
+	for i := range buckets {
+		buckets[i].UpperBound = fastest + step*float64(i+1)
+	}
+	buckets[histogramBuckets-1].UpperBound = slowest
+
+	bucket := 0
+	for _, latency := range sorted {
+		for bucket < histogramBuckets-1 && latency > buckets[bucket].UpperBound {
+			bucket++
+		}
+		buckets[bucket].Count++
+	}
+	return buckets
+}
+
+func classifyBenchError(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return fmt.Sprintf("%s error", opErr.Op)
+	}
+	return err.Error()
+}
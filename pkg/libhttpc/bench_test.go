@@ -0,0 +1,12 @@
+package libhttpc
+
+import "testing"
+
+func TestRunBenchmarkRejectsOutOfRangeRate(t *testing.T) {
+	for _, rate := range []float64{2e9, 1e-12} {
+		options := BenchOptions{Method: "GET", URL: "http://127.0.0.1:1/", Transport: TransportTCP, Requests: 1, Rate: rate}
+		if _, err := RunBenchmark(options); err == nil {
+			t.Errorf("rate %g: want an error", rate)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package libhttpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Cassette modes: record always sends and overwrites what was recorded,
+// replay never touches the network and auto replays what it has and records
+// the rest.
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+	CassetteAuto   = "auto"
+)
+
+// CassetteRequest is the part of a request the matchers compare.
+type CassetteRequest struct {
+	Transport string            `json:"transport"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body,omitempty"`
+}
+
+// CassetteInteraction is one recorded exchange; Response is the raw response.
+type CassetteInteraction struct {
+	Request  CassetteRequest `json:"request"`
+	Response string          `json:"response"`
+}
+
+// Matcher reports whether a recorded request answers an incoming one.
+type Matcher func(recorded *CassetteRequest, incoming *CassetteRequest) bool
+
+// Cassette is a Doer recording exchanges to a JSON file and replaying them.
+// A recorded interaction is replayed once while unused matching ones are
+// left, so repeated identical requests get their responses in order.
+type Cassette struct {
+	Matchers []Matcher
+
+	mutex        sync.Mutex
+	path         string
+	mode         string
+	next         Doer
+	interactions []CassetteInteraction
+	used         []bool
+}
+
+// DefaultMatchers compare the method and the URL.
+var DefaultMatchers = []Matcher{MatchMethod, MatchURL}
+
+// NewCassette loads the cassette at path, which may not exist yet outside
+// replay mode. Requests that have to be recorded are sent through next.
+func NewCassette(path string, mode string, next Doer) (*Cassette, error) {
+	if mode != CassetteRecord && mode != CassetteReplay && mode != CassetteAuto {
+		return nil, fmt.Errorf("Unknown cassette mode '%s', expected record, replay or auto", mode)
+	}
+	if next == nil {
+		next = Client{}
+	}
+	cassette := &Cassette{Matchers: DefaultMatchers, path: path, mode: mode, next: next}
+	if mode == CassetteRecord {
+		return cassette, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && mode == CassetteAuto {
+		return cassette, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &cassette.interactions); err != nil {
+		return nil, fmt.Errorf("Invalid cassette %s: %s", path, err.Error())
+	}
+	cassette.used = make([]bool, len(cassette.interactions))
+	return cassette, nil
+}
+
+// Send replays the matching interaction or, when the mode allows it, sends
+// the request and writes the cassette with the new interaction added.
+func (cassette *Cassette) Send(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	incoming := CassetteRequest{
+		Transport: transport,
+		Method:    strings.ToUpper(method),
+		URL:       inputUrl,
+		Headers:   map[string]string{},
+		Body:      string(body),
+	}
+	for key, value := range headers {
+		incoming.Headers[key] = strings.TrimSpace(value)
+	}
+
+	cassette.mutex.Lock()
+	defer cassette.mutex.Unlock()
+	if cassette.mode != CassetteRecord {
+		if response, ok := cassette.replay(&incoming); ok {
+			return response, nil
+		}
+		if cassette.mode == CassetteReplay {
+			return BlankString, fmt.Errorf("No interaction recorded in %s for %s %s", cassette.path, incoming.Method, inputUrl)
+		}
+	}
+
+	response, err := cassette.next.Send(transport, method, inputUrl, headers, body)
+	if err != nil {
+		return BlankString, err
+	}
+	cassette.interactions = append(cassette.interactions, CassetteInteraction{Request: incoming, Response: response})
+	cassette.used = append(cassette.used, true)
+	return response, cassette.save()
+}
+
+func (cassette *Cassette) replay(incoming *CassetteRequest) (string, bool) {
+	last := -1
+	for i := range cassette.interactions {
+		if !cassette.matches(&cassette.interactions[i].Request, incoming) {
+			continue
+		}
+		if !cassette.used[i] {
+			cassette.used[i] = true
+			return cassette.interactions[i].Response, true
+		}
+		last = i
+	}
+	if last == -1 {
+		return BlankString, false
+	}
+	return cassette.interactions[last].Response, true
+}
+
+func (cassette *Cassette) matches(recorded *CassetteRequest, incoming *CassetteRequest) bool {
+	for _, matcher := range cassette.Matchers {
+		if !matcher(recorded, incoming) {
+			return false
+		}
+	}
+	return true
+}
+
+// Interactions returns a copy of the recorded interactions.
+func (cassette *Cassette) Interactions() []CassetteInteraction {
+	cassette.mutex.Lock()
+	defer cassette.mutex.Unlock()
+	interactions := make([]CassetteInteraction, len(cassette.interactions))
+	copy(interactions, cassette.interactions)
+	return interactions
+}
+
+func (cassette *Cassette) save() error {
+	encoded, err := json.MarshalIndent(cassette.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cassette.path, append(encoded, '\n'), 0644)
+}
+
+func MatchMethod(recorded *CassetteRequest, incoming *CassetteRequest) bool {
+	return recorded.Method == incoming.Method
+}
+
+func MatchURL(recorded *CassetteRequest, incoming *CassetteRequest) bool {
+	return recorded.URL == incoming.URL
+}
+
+func MatchBody(recorded *CassetteRequest, incoming *CassetteRequest) bool {
+	return recorded.Body == incoming.Body
+}
+
+// MatchHeaders compares the named headers, or all of them when none is
+// named. Names are not case sensitive.
+func MatchHeaders(names ...string) Matcher {
+	return func(recorded *CassetteRequest, incoming *CassetteRequest) bool {
+		keys := names
+		if len(keys) == 0 {
+			keys = headerNames(recorded.Headers, incoming.Headers)
+		}
+		for _, key := range keys {
+			if headerValue(recorded.Headers, key) != headerValue(incoming.Headers, key) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ParseMatchers builds matchers from names such as "method,url,body" or
+// "headers:Accept:Authorization".
+func ParseMatchers(spec string) ([]Matcher, error) {
+	var matchers []Matcher
+	for _, name := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(name), ":")
+		switch strings.ToLower(parts[0]) {
+		case "method":
+			matchers = append(matchers, MatchMethod)
+		case "url":
+			matchers = append(matchers, MatchURL)
+		case "body":
+			matchers = append(matchers, MatchBody)
+		case "headers":
+			matchers = append(matchers, MatchHeaders(parts[1:]...))
+		default:
+			return nil, fmt.Errorf("Unknown matcher '%s', expected method, url, headers or body", parts[0])
+		}
+	}
+	return matchers, nil
+}
+
+func headerNames(headerMaps ...map[string]string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, headers := range headerMaps {
+		for key := range headers {
+			if lower := strings.ToLower(key); !seen[lower] {
+				seen[lower] = true
+				names = append(names, lower)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func headerValue(headers map[string]string, key string) string {
+	for name, value := range headers {
+		if strings.EqualFold(name, key) {
+			return value
+		}
+	}
+	return BlankString
+}
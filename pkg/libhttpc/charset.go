@@ -0,0 +1,170 @@
+package libhttpc
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Charsets DecodeText understands, by their canonical name.
+const (
+	CharsetUTF8        = "utf-8"
+	CharsetUTF16LE     = "utf-16le"
+	CharsetUTF16BE     = "utf-16be"
+	CharsetWindows1252 = "windows-1252"
+	CharsetISO885915   = "iso-8859-15"
+)
+
+// charsetAliases maps labels to canonical names. As in browsers, ASCII and
+// Latin-1 labels mean windows-1252, its superset.
+var charsetAliases = map[string]string{
+	"utf-8": CharsetUTF8, "utf8": CharsetUTF8, "unicode-1-1-utf-8": CharsetUTF8,
+	"utf-16": CharsetUTF16LE, "utf-16le": CharsetUTF16LE, "unicode": CharsetUTF16LE, "ucs-2": CharsetUTF16LE,
+	"utf-16be": CharsetUTF16BE, "unicodefffe": CharsetUTF16BE,
+	"us-ascii": CharsetWindows1252, "ascii": CharsetWindows1252, "iso-8859-1": CharsetWindows1252,
+	"iso8859-1": CharsetWindows1252, "iso_8859-1": CharsetWindows1252, "latin1": CharsetWindows1252,
+	"l1": CharsetWindows1252, "cp1252": CharsetWindows1252, "windows-1252": CharsetWindows1252,
+	"x-cp1252": CharsetWindows1252, "cp819": CharsetWindows1252, "ibm819": CharsetWindows1252,
+	"iso-8859-15": CharsetISO885915, "iso8859-15": CharsetISO885915, "iso_8859-15": CharsetISO885915,
+	"latin9": CharsetISO885915, "l9": CharsetISO885915,
+}
+
+// windows1252High holds the characters of bytes 0x80 to 0x9F; the other
+// bytes are the Unicode code point of the same value. Undefined bytes map
+// to their C1 control code.
+var windows1252High = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// iso885915Changes are the code points ISO-8859-15 changed from Latin-1.
+var iso885915Changes = map[byte]rune{
+	0xA4: '€', 0xA6: 'Š', 0xA8: 'š', 0xB4: 'Ž', 0xB8: 'ž', 0xBC: 'Œ', 0xBD: 'œ', 0xBE: 'Ÿ',
+}
+
+// the sniffed declarations only look at the start of the body, as browsers do
+const charsetSniffLength = 1024
+
+var metaCharsetPattern = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.-]+)`)
+var xmlEncodingPattern = regexp.MustCompile(`^<\?xml[^>]+encoding\s*=\s*["']([a-zA-Z0-9_.-]+)["']`)
+
+// CanonicalCharset returns the canonical name of a charset label, or an
+// empty string when it is not supported.
+func CanonicalCharset(label string) string {
+	return charsetAliases[strings.ToLower(strings.Trim(strings.TrimSpace(label), `"'`))]
+}
+
+// DetectCharset finds the charset of a body: a byte order mark first, then
+// the Content-Type charset parameter, then a <meta> or <?xml?> declaration.
+// Without any, UTF-8 is assumed when the body is valid UTF-8 and
+// windows-1252 otherwise. Unsupported labels are skipped.
+func DetectCharset(contentType string, body []byte) string {
+	switch {
+	case bytes.HasPrefix(body, []byte{0xEF, 0xBB, 0xBF}):
+		return CharsetUTF8
+	case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+		return CharsetUTF16LE
+	case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+		return CharsetUTF16BE
+	}
+
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if charset := CanonicalCharset(params["charset"]); charset != BlankString {
+			return charset
+		}
+	}
+
+	start := body
+	if len(start) > charsetSniffLength {
+		start = start[:charsetSniffLength]
+	}
+	for _, pattern := range []*regexp.Regexp{xmlEncodingPattern, metaCharsetPattern} {
+		if match := pattern.FindSubmatch(start); match != nil {
+			// a page that reached us as bytes cannot really be UTF-16
+			if charset := CanonicalCharset(string(match[1])); charset != BlankString &&
+				charset != CharsetUTF16LE && charset != CharsetUTF16BE {
+				return charset
+			}
+		}
+	}
+
+	if utf8.Valid(body) {
+		return CharsetUTF8
+	}
+	return CharsetWindows1252
+}
+
+// DecodeText converts body from charset to UTF-8, dropping a byte order
+// mark. Invalid UTF-8 is replaced with U+FFFD.
+func DecodeText(charset string, body []byte) (string, error) {
+	canonical := CanonicalCharset(charset)
+	switch canonical {
+	case CharsetUTF8:
+		return strings.ToValidUTF8(string(bytes.TrimPrefix(body, []byte{0xEF, 0xBB, 0xBF})), "�"), nil
+	case CharsetUTF16LE, CharsetUTF16BE:
+		return decodeUTF16(body, canonical == CharsetUTF16BE), nil
+	case CharsetWindows1252, CharsetISO885915:
+		var text strings.Builder
+		for _, char := range body {
+			switch {
+			case canonical == CharsetWindows1252 && char >= 0x80 && char <= 0x9F:
+				text.WriteRune(windows1252High[char-0x80])
+			case canonical == CharsetISO885915 && iso885915Changes[char] != 0:
+				text.WriteRune(iso885915Changes[char])
+			default:
+				text.WriteRune(rune(char))
+			}
+		}
+		return text.String(), nil
+	}
+	return BlankString, fmt.Errorf("Unsupported charset '%s'", charset)
+}
+
+func decodeUTF16(body []byte, bigEndian bool) string {
+	if len(body) >= 2 && (bigEndian && body[0] == 0xFE && body[1] == 0xFF || !bigEndian && body[0] == 0xFF && body[1] == 0xFE) {
+		body = body[2:]
+	}
+	units := make([]uint16, 0, len(body)/2)
+	for i := 0; i+1 < len(body); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(body[i])<<8|uint16(body[i+1]))
+		} else {
+			units = append(units, uint16(body[i+1])<<8|uint16(body[i]))
+		}
+	}
+	text := string(utf16.Decode(units))
+	if len(body)%2 == 1 {
+		text += "�"
+	}
+	return text
+}
+
+// IsTextContentType tells whether a Content-Type is text that can be
+// transcoded: text/*, JSON or XML, or any type with a charset parameter.
+func IsTextContentType(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if params["charset"] != BlankString {
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" || mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// Charset is the detected charset of the response body.
+func (response *Response) Charset() string {
+	return DetectCharset(response.Header("Content-Type"), []byte(response.Body))
+}
+
+// Text is the body decoded to UTF-8 from its detected charset. Body keeps
+// the bytes as received.
+func (response *Response) Text() (string, error) {
+	return DecodeText(response.Charset(), []byte(response.Body))
+}
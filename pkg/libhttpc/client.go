@@ -1,450 +1,165 @@
 package libhttpc
 
 import (
-	"encoding/binary"
+	"bytes"
 	"errors"
 	"fmt"
+	"httpc/pkg/rudp"
 	"io"
-	"math"
+	"io/ioutil"
 	"net"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
-func ParsePacket(data []byte) UDPPacket {
-	pType := data[0]
-	seqNo := data[1:5]
-	peerAddr := data[5:9]
-	peerPort := data[9:11]
-	payload := data[11:]
+// connectFunc opens the connection of a request and returns its URL and
+// the header lines to send.
+type connectFunc func(inputUrl string, headers RequestHeader) (*url.URL, string, net.Conn, error)
 
-	return UDPPacket{
-		pType:    []byte{pType},
-		seqNo:    seqNo,
-		peerAddr: peerAddr,
-		peerPort: peerPort,
-		payload:  payload,
-	}
+func UDPGet(inputUrl string, headers RequestHeader) (string, error) {
+	return UDPDo("GET", inputUrl, headers, nil)
 }
 
-func makePacket(pType uint32, seqNo uint32, parsedURL *url.URL, payload string) UDPPacket {
-
-	// pType, one of the following: 0 - Data, 1- ACK, 2 - SYN, 3 - SYN-ACK, 4 - NAK; 1 byte
-	pTypeByte := []byte{byte(pType)}
-
-	// seqNo, for SYN it is the initial pNo during 3WH -- else incremental packet numbers; 4 bytes BE
-	seqNoBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(seqNoBytes, seqNo)
-
-	// peerAddr, either sender/receiver -- translated by router!; 4 bytes
-	peerAddrBytes := make([]byte, 4)
-	addrSplit := strings.Split(parsedURL.Host, ":")
-	peerAddr := addrSplit[0]
-	peerAddrSplit := strings.Split(peerAddr, ".")
-	for i, section := range peerAddrSplit {
-		intSection, _ := strconv.Atoi(section)
-		peerAddrBytes[i] = byte(intSection)
-	}
-
-	//peerAddrBytes := make([]byte, 4)
-	//binary.BigEndian.PutUint32(peerAddrBytes, peerAddr)
-
-	// peerPort, either sender/receiver -- translated by router!; 2 bytes BE
-	peerPortBytes := make([]byte, 2)
-	peerPortInt, _ := strconv.Atoi(addrSplit[1])
-	binary.BigEndian.PutUint16(peerPortBytes, uint16(peerPortInt))
-
-	// payload; max 1013 bytes
-	// TODO handle size constraints/breaking somehow...
-	payloadBytes := []byte(payload)
-
-	// Packet Size Range: 11 (no payload) to 1024 (full payload)
-
-	return UDPPacket{
-		pType:    pTypeByte,
-		seqNo:    seqNoBytes,
-		peerAddr: peerAddrBytes,
-		peerPort: peerPortBytes,
-		payload:  payloadBytes,
-	}
+func UDPPost(inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	headers["Content-Length"] = fmt.Sprintf("%d", len(body))
+	return UDPDo("POST", inputUrl, headers, body)
 }
 
-func getDataPacketBytes(seqNo uint32, parsedURL *url.URL, payload string) ([][]byte, int) {
-	numPackets := int(math.Ceil(float64(len(payload)) / float64(1013)))
-	packetsBytes := make([][]byte, numPackets)
-	payloadBytes := []byte(payload)
-
-	if numPackets == 1 {
-		packetBytes := getBytesFromPacket(makePacket(0, seqNo, parsedURL, payload))
-		packetsBytes[0] = packetBytes
-		return packetsBytes, 1
-	}
-
-	counter := 0
-	for i := 1; i < numPackets; i++ {
-		chunk := payloadBytes[counter : counter+1013]
-		packetForChunk := makePacket(0, seqNo, parsedURL, string(chunk))
-		packetsBytes[i-1] = getBytesFromPacket(packetForChunk)
-		counter += 1013
-		seqNo++
+// UDPDo is Do over the reliable UDP transport, through the router.
+func UDPDo(method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	if len(body) > 0 {
+		headers["Content-Length"] = fmt.Sprintf("%d", len(body))
 	}
-	residue := len(payload) % 1013
-	if residue > 0 {
-		residueChunk := payloadBytes[counter:]
-		packetsBytes[numPackets-1] = getBytesFromPacket(makePacket(0, seqNo, parsedURL, string(residueChunk)))
-	}
-	return packetsBytes, numPackets
+	record := exchange{started: time.Now(), method: strings.ToUpper(method), url: inputUrl, headers: headers, body: body}
+	return doRequest(&record, bytes.NewReader(body), udpConnectHandler)
 }
 
-func handshake(conn *net.UDPConn, parsedURL *url.URL, numPackets int) {
-	for {
-		deadline := time.Now().Add(2 * time.Second)
-		//wTimeoutErr := conn.SetWriteDeadline(deadline)
-		rTimeoutErr := conn.SetReadDeadline(deadline)
-		//if wTimeoutErr != nil || rTimeoutErr != nil {
-		if rTimeoutErr != nil {
-			fmt.Println("Timing out!")
-		}
-
-		seqInit := uint32(1)
-		packet := makePacket(2, seqInit, parsedURL, fmt.Sprintf("%d", numPackets))
-		packetBytes := getBytesFromPacket(packet)
-
-		_, err := conn.Write(packetBytes)
-		if err != nil {
-			fmt.Println(err)
-		}
-
-		readBuf := make([]byte, 11)
-		_, _, readErr := conn.ReadFromUDP(readBuf)
-		if readErr != nil {
-			fmt.Println("I/O timeout, retransmissing...")
-			continue
-		}
-
-		synAck := ParsePacket(readBuf)
-		receivedSeq := binary.BigEndian.Uint32(synAck.seqNo)
-		if synAck.pType[0] == 3 && receivedSeq == seqInit+1 {
-			packet = makePacket(1, receivedSeq+1, parsedURL, "")
-			packetBytes = getBytesFromPacket(packet)
-
-			_, err := conn.Write(packetBytes)
-			if err != nil {
-				fmt.Println(err)
-			}
-			break
-		} else {
-			fmt.Println("Invalid packet type or sequence number, ignoring.")
-		}
-	}
+func Get(inputUrl string, headers RequestHeader) (string, error) {
+	return Do("GET", inputUrl, headers, nil)
 }
 
-func getBytesFromPacket(packet UDPPacket) []byte {
-	packetBytes := append(packet.pType, packet.seqNo...)
-	packetBytes = append(packetBytes, packet.peerAddr...)
-	packetBytes = append(packetBytes, packet.peerPort...)
-	packetBytes = append(packetBytes, packet.payload...)
-	return packetBytes
+func Post(inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	headers["Content-Length"] = fmt.Sprintf("%d", len(body))
+	return Do("POST", inputUrl, headers, body)
 }
 
-func remove(packetList []UDPPacket, removePack UDPPacket) []UDPPacket {
-	for i, curr := range packetList {
-		if binary.BigEndian.Uint32(curr.seqNo) == binary.BigEndian.Uint32(removePack.seqNo) {
-			return append(packetList[:i], packetList[i+1:]...)
-		}
+func Do(method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	if len(body) > 0 {
+		headers["Content-Length"] = fmt.Sprintf("%d", len(body))
 	}
-	return packetList
+	record := exchange{started: time.Now(), method: strings.ToUpper(method), url: inputUrl, headers: headers, body: body}
+	return doRequest(&record, bytes.NewReader(body), connectHandler)
 }
 
-func UDPGet(inputUrl string, headers RequestHeader) (string, error) {
-	parsedURL, parsedHeaders, conn, err := udpConnectHandler(inputUrl, headers)
-
-	if err != nil {
-		return BlankString, err
-	}
-
-	defer conn.Close()
-	requestString := fmt.Sprintf(
-		"GET %s %s%s%s%s%s",
-		parsedURL.RequestURI(), ProtocolVersion, CRLF,
-		parsedHeaders, CRLF, CRLF)
-
-	packets, numPackets := getDataPacketBytes(4, parsedURL, requestString)
-
-	// make handshake
-	handshake(conn, parsedURL, numPackets)
-
-	// start a goroutine listener for the ACKs/NAKs
-	packetChan := make(chan UDPPacket)
-
-	var responsePayload []string
-	numOfResponsePackets := -1
-	var nakList []UDPPacket
-
-	go func() {
-		// if NAKs are dropped, try again...
-		for packet := range packetChan {
-			if packet.pType[0] == 4 {
-				fmt.Println("Handling NAK")
-				missingNo := binary.BigEndian.Uint32(packet.seqNo)
-				missingPacket := packets[int(missingNo)-4]
-				_, err = conn.Write(missingPacket)
-				if err != nil {
-					fmt.Println(err)
-				}
-			}
-		}
-	}()
-
-	for _, packetBytes := range packets {
-		_, err = conn.Write(packetBytes)
-		if err != nil {
-			fmt.Println(err)
-		}
-	}
-
-	var responsePacket UDPPacket
-	var expectedSeqNo uint32
-	expectedSeqNo = 1
-	acks := make([]uint32, 5)
-	naks := make([]uint32, 5)
-
-	for {
-		readBuf := make([]byte, 1024)
-		_, _, readErr := conn.ReadFromUDP(readBuf)
-		responsePacket = ParsePacket(readBuf)
-		if readErr != nil {
-			continue
-		}
-
-		if responsePacket.pType[0] == 1 || responsePacket.pType[0] == 4 {
-			select {
-			case packetChan <- responsePacket:
-			default:
-				// loop again
-			}
-		}
-
-		if responsePacket.pType[0] == 4 {
-			nakList = append(nakList, responsePacket)
-		} else if responsePacket.pType[0] == 1 {
-			nakList = remove(nakList, responsePacket)
-		}
-
-		if responsePacket.pType[0] == 0 {
-			if numOfResponsePackets == -1 {
-				numOfResponsePackets = int(responsePacket.payload[len(responsePacket.payload)-1])
-				if numOfResponsePackets == 0 {
-					numOfResponsePackets = 1
-				}
-				responsePayload = make([]string, numOfResponsePackets+5)
-			}
-			responseSeq := binary.BigEndian.Uint32(responsePacket.seqNo)
-
-			responsePacketPayloadLength := len(responsePacket.payload) - 1
-			responseSlice := responsePacket.payload[0 : responsePacketPayloadLength-1]
-			responsePayload[responseSeq] = string(responseSlice)
-			acks = append(acks, responseSeq)
-			if responseSeq == expectedSeqNo {
-				ackPacket := makePacket(4, responseSeq, parsedURL, "")
-				packetBytes := getBytesFromPacket(ackPacket)
-				_, writeErr := conn.Write(packetBytes)
-				if writeErr != nil {
-					fmt.Println("Timeout writing ACK!")
-				}
-				//fmt.Println(fmt.Sprintf("ACK'd packet %d", responseSeq))
-				expectedSeqNo++
-			} else if responseSeq < expectedSeqNo {
-				// SEND ACK
-				ackPacket := makePacket(4, responseSeq, parsedURL, "")
-				packetBytes := getBytesFromPacket(ackPacket)
-				_, writeErr := conn.Write(packetBytes)
-				if writeErr != nil {
-					fmt.Println("Timeout writing ACK!")
-				}
-				//fmt.Println(fmt.Sprintf("ACK'd packet %d", responseSeq))
-			} else {
-				for packetNum := expectedSeqNo; packetNum < responseSeq; packetNum++ {
-					naks = append(naks, packetNum)
-					nakPacket := makePacket(4, packetNum, parsedURL, "")
-					packetBytes := getBytesFromPacket(nakPacket)
-					_, writeErr := conn.Write(packetBytes)
-					if writeErr != nil {
-						fmt.Println("Timeout writing NAKs!")
-					}
-					//fmt.Println(fmt.Sprintf("NAK'd packet %d", packetNum))
-				}
-				expectedSeqNo = responseSeq + 1
-			}
-			if numOfResponsePackets == 1 {
-				return responsePayload[responseSeq], nil
-			} else if checkNotEmpty(responsePayload[1 : numOfResponsePackets+1]) {
-				return stringifiedResponse(responsePayload[1 : numOfResponsePackets+1]), nil
-			}
+// DoStream executes a request whose body is copied from body as it is sent
+// instead of being held in memory. length must be the exact body size.
+func DoStream(method string, inputUrl string, headers RequestHeader, body io.Reader, length int64) (string, error) {
+	return doStream(method, inputUrl, headers, body, length, connectHandler)
+}
 
-		}
-	}
+// UDPDoStream is DoStream over the reliable UDP transport, through the router.
+func UDPDoStream(method string, inputUrl string, headers RequestHeader, body io.Reader, length int64) (string, error) {
+	return doStream(method, inputUrl, headers, body, length, udpConnectHandler)
 }
 
-func stringifiedResponse(responsePayload []string) string {
-	response := ""
-	for _, stringifiedPacket := range responsePayload {
-		response += stringifiedPacket
+func doStream(method string, inputUrl string, headers RequestHeader, body io.Reader, length int64, connect connectFunc) (string, error) {
+	headers["Content-Length"] = fmt.Sprintf("%d", length)
+	record := exchange{started: time.Now(), method: strings.ToUpper(method), url: inputUrl, headers: headers}
+	if recording() {
+		record.captured = &bodyCapture{}
+		body = io.TeeReader(body, record.captured)
 	}
-	return response
+	return doRequest(&record, body, connect)
 }
 
-func UDPPost(inputUrl string, headers RequestHeader, body []byte) (string, error) {
-	headers["Content-Length"] = fmt.Sprintf("%d", len(body))
-	parsedURL, parsedHeaders, conn, err := udpConnectHandler(inputUrl, headers)
+func doRequest(record *exchange, body io.Reader, connect connectFunc) (string, error) {
+	parsedURL, parsedHeaders, conn, err := connect(record.url, record.headers)
 
 	if err != nil {
 		return BlankString, err
 	}
 
 	defer conn.Close()
-
-	requestString := fmt.Sprintf("POST %s %s%s%s%s%s%s",
-		parsedURL.RequestURI(), ProtocolVersion, CRLF,
-		parsedHeaders, CRLF, body, CRLF)
-
-	packets, numPackets := getDataPacketBytes(4, parsedURL, requestString)
-
-	// ack packets
-	ackPackets := make([]UDPPacket, numPackets)
-	for i, copyPacket := range packets {
-		ackPackets[i] = ParsePacket(copyPacket)
-	}
-
-	// make handshake
-	handshake(conn, parsedURL, numPackets)
-
-	// start a goroutine listener for the ACKs/NAKs
-	packetChan := make(chan UDPPacket, 1024)
-
-	go func() {
-		var nakList []UDPPacket
-
-		for packet := range packetChan {
-			if packet.pType[0] == 4 {
-				nakList = append(nakList, packet)
-			} else if packet.pType[0] == 1 {
-				nakList = remove(nakList, packet)
-			}
-
-			for _, nakPack := range nakList {
-				fmt.Println("Sending NAK!")
-				missingNo := binary.BigEndian.Uint32(nakPack.seqNo)
-				missingPacket := packets[int(missingNo)-4]
-				_, err = conn.Write(missingPacket)
-				if err != nil {
-					fmt.Println(err)
-				}
-			}
-		}
-	}()
-
-	for _, packetBytes := range packets {
-		_, err = conn.Write(packetBytes)
-		if err != nil {
-			fmt.Println(err)
-		}
-	}
-	var responsePacket UDPPacket
-
-	for {
-		readBuf := make([]byte, 1024)
-		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-		_, _, err = conn.ReadFromUDP(readBuf)
-		responsePacket = ParsePacket(readBuf)
-
-		if err != nil {
-			// retransmission of packets not ACK'd
-			for _, lostPacket := range ackPackets {
-				fmt.Println("Sending lost packet!")
-				_, err = conn.Write(getBytesFromPacket(lostPacket))
-				if err != nil {
-					fmt.Println(err)
-				}
-			}
-			continue
-		}
-
-		if responsePacket.pType[0] == 1 || responsePacket.pType[0] == 4 {
-			if responsePacket.pType[0] == 1 {
-				ackPackets = remove(ackPackets, responsePacket)
-			}
-			select {
-			case packetChan <- responsePacket:
-				// do nothing
-				packetChan <- responsePacket
-			default:
-				// buffer is full
-				//fmt.Println("channel buffer overflow!")
-			}
-		}
-
-		if responsePacket.pType[0] == 0 {
-			break
-		}
-	}
-
-	return string(responsePacket.payload), nil
-}
-
-func Get(inputUrl string, headers RequestHeader) (string, error) {
-	parsedURL, parsedHeaders, conn, err := connectHandler(inputUrl, headers)
-
+	record.connect = time.Since(record.started)
+	record.serverIP = hostOf(conn.RemoteAddr())
+
+	requestString := fmt.Sprintf("%s %s %s%s%s%s",
+		record.method, parsedURL.RequestURI(), ProtocolVersion, CRLF,
+		parsedHeaders, CRLF)
+	sendStart := time.Now()
+	_, err = conn.Write([]byte(requestString))
 	if err != nil {
 		return BlankString, err
 	}
-
-	defer conn.Close()
-	requestString := fmt.Sprintf(
-		"GET %s %s%s%s%s%s",
-		parsedURL.RequestURI(), ProtocolVersion, CRLF,
-		parsedHeaders, CRLF, CRLF)
-
-	fmt.Fprintf(conn, requestString)
-	response, err := readResponseFromConnection(conn)
-
+	_, err = io.Copy(conn, body)
 	if err != nil {
-		return BlankString, nil
+		return BlankString, err
 	}
+	record.send = time.Since(sendStart)
 
-	return string(response), nil
-}
-
-func Post(inputUrl string, headers RequestHeader, body []byte) (string, error) {
-	headers["Content-Length"] = fmt.Sprintf("%d", len(body))
-	parsedURL, parsedHeaders, conn, err := connectHandler(inputUrl, headers)
+	waitStart := time.Now()
+	response, firstByte, err := readResponseFromConnection(conn)
 
 	if err != nil {
 		return BlankString, err
 	}
+	record.wait = firstByte.Sub(waitStart)
+	record.receive = time.Since(firstByte)
+	record.response = string(response)
+	recordExchange(record)
 
-	defer conn.Close()
+	return string(response), nil
+}
 
-	requestString := fmt.Sprintf("POST %s %s%s%s%s%s%s",
-		parsedURL.RequestURI(), ProtocolVersion, CRLF,
-		parsedHeaders, CRLF, body, CRLF)
-	fmt.Fprintf(conn, requestString)
+// Send executes a request through the client set with SetClient, by
+// default over the given transport.
+// headers is copied first, so what middlewares add stays out of the caller's
+// map.
+func Send(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	doer, _ := currentClient(true)
+	return doer.Send(transport, method, inputUrl, copyHeaders(headers), body)
+}
 
-	fmt.Println(requestString)
+// sendAnonymous is Send without the credential middlewares.
+func sendAnonymous(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	doer, _ := currentClient(false)
+	return doer.Send(transport, method, inputUrl, copyHeaders(headers), body)
+}
 
-	response, err := readResponseFromConnection(conn)
+func send(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	method = strings.ToUpper(method)
+	switch transport {
+	case TransportTCP:
+		return Do(method, inputUrl, headers, body)
+	case TransportUDP:
+		return UDPDo(method, inputUrl, headers, body)
+	}
+	return BlankString, fmt.Errorf("Unknown transport '%s'", transport)
+}
 
+// SendStream is Send for a streamed body. Clients other than the default one
+// or with middlewares read the whole body into memory first.
+func SendStream(transport string, method string, inputUrl string, headers RequestHeader, body io.Reader, length int64) (string, error) {
+	if _, direct := currentClient(true); direct {
+		switch transport {
+		case TransportTCP:
+			return DoStream(method, inputUrl, copyHeaders(headers), body, length)
+		case TransportUDP:
+			return UDPDoStream(method, inputUrl, copyHeaders(headers), body, length)
+		}
+	}
+	content, err := ioutil.ReadAll(body)
 	if err != nil {
 		return BlankString, err
 	}
-
-	return string(response), nil
+	return Send(transport, method, inputUrl, headers, content)
 }
 
 func FromString(response string) (*Response, error) {
-	responseSplit := strings.Split(response, CRLF+CRLF)
+	responseSplit := strings.SplitN(response, CRLF+CRLF, 2)
 	// splits between (statusLine + headers) and Body
 	if len(responseSplit) == 2 {
 		response := Response{}
@@ -474,25 +189,38 @@ func FromString(response string) (*Response, error) {
 	return nil, nil
 }
 
-func HandleRedirects(response *Response, responseString string, headers RequestHeader, redirectCount int) (string, error) {
-	var err error
+// HandleRedirects follows the redirects of the response to inputUrl through
+// Send, over transport. Every hop starts from headers, the ones the user
+// gave, and hops to another origin leave out Authorization, Host and the
+// credential middlewares. onRedirect, when set, is told about every hop.
+func HandleRedirects(response *Response, responseString string, transport string, inputUrl string, headers RequestHeader, redirectCount int, onRedirect func(statusCode int, location string)) (string, error) {
+	currentURL := inputUrl
 	for ; redirectCount < 5; redirectCount++ {
 		if response.StatusCode >= 301 && response.StatusCode <= 303 {
-			redirectURI := extractRedirectURI(response.Headers)
-			fmt.Printf("Encountered status code %d...Redirecting to %s\n", response.StatusCode, redirectURI)
-			if redirectURI != "" {
-				responseString, err = Get(redirectURI, headers)
-				if err != nil {
-					return "", err
-				}
-
-				response, err = FromString(responseString)
-				if err != nil {
-					return "", err
-				}
-			} else {
-				return "", errors.New("Bad redirect URI in Location header")
+			redirectURI, err := resolveRedirect(currentURL, extractRedirectURI(response.Headers))
+			if err != nil {
+				return "", err
+			}
+			if onRedirect != nil {
+				onRedirect(response.StatusCode, redirectURI)
 			}
+			hop := Send
+			if !sameOrigin(inputUrl, redirectURI) {
+				hop = sendAnonymous
+			}
+			responseString, err = hop(transport, "GET", redirectURI, redirectHeaders(headers, inputUrl, redirectURI), nil)
+			if err != nil {
+				return "", err
+			}
+
+			response, err = FromString(responseString)
+			if err != nil {
+				return "", err
+			}
+			if response == nil {
+				return "", errors.New("Malformed response")
+			}
+			currentURL = redirectURI
 		} else {
 			return responseString, nil
 		}
@@ -500,6 +228,93 @@ func HandleRedirects(response *Response, responseString string, headers RequestH
 	return "", errors.New("Exceeded 5 redirects!")
 }
 
+// resolveRedirect resolves a Location, which may be relative, against the
+// URL that was redirected.
+func resolveRedirect(currentURL string, location string) (string, error) {
+	if location == BlankString {
+		return BlankString, errors.New("Bad redirect URI in Location header")
+	}
+	base, err := url.Parse(currentURL)
+	if err != nil {
+		return BlankString, err
+	}
+	target, err := base.Parse(location)
+	if err != nil {
+		return BlankString, errors.New("Bad redirect URI in Location header")
+	}
+	return target.String(), nil
+}
+
+// redirectHeaders copies headers for a redirect hop. Credentials and the Host
+// the user gave for inputUrl are not sent to another origin.
+func redirectHeaders(headers RequestHeader, inputUrl string, redirectURI string) RequestHeader {
+	hopHeaders := copyHeaders(headers)
+	if sameOrigin(inputUrl, redirectURI) {
+		return hopHeaders
+	}
+	for key := range hopHeaders {
+		if strings.EqualFold(key, "Authorization") || strings.EqualFold(key, "Host") {
+			delete(hopHeaders, key)
+		}
+	}
+	return hopHeaders
+}
+
+func sameOrigin(first string, second string) bool {
+	firstURL, err := url.Parse(first)
+	if err != nil {
+		return false
+	}
+	secondURL, err := url.Parse(second)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(firstURL.Scheme, secondURL.Scheme) &&
+		strings.EqualFold(firstURL.Hostname(), secondURL.Hostname()) &&
+		defaultPort(firstURL) == defaultPort(secondURL)
+}
+
+func defaultPort(parsedURL *url.URL) string {
+	if port := parsedURL.Port(); port != BlankString {
+		return port
+	}
+	if strings.EqualFold(parsedURL.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
+
+func copyHeaders(headers RequestHeader) RequestHeader {
+	copied := make(RequestHeader, len(headers))
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
+
+// Header returns the value of the first response header matching key, ignoring case.
+func (response *Response) Header(key string) string {
+	for _, header := range strings.Split(response.Headers, "\n") {
+		indexOfSeparator := strings.Index(header, ":")
+		if indexOfSeparator > -1 && strings.EqualFold(strings.TrimSpace(header[:indexOfSeparator]), key) {
+			return strings.TrimSpace(header[indexOfSeparator+1:])
+		}
+	}
+	return BlankString
+}
+
+// HeaderValues returns every value of a repeated header such as Set-Cookie.
+func (response *Response) HeaderValues(key string) []string {
+	var values []string
+	for _, header := range strings.Split(response.Headers, "\n") {
+		indexOfSeparator := strings.Index(header, ":")
+		if indexOfSeparator > -1 && strings.EqualFold(strings.TrimSpace(header[:indexOfSeparator]), key) {
+			values = append(values, strings.TrimSpace(header[indexOfSeparator+1:]))
+		}
+	}
+	return values
+}
+
 func extractRedirectURI(headers string) string {
 	headerLines := strings.Split(headers, "\n")
 	for _, header := range headerLines {
@@ -524,46 +339,88 @@ func parseStatusCode(statusCode string) (int, error) {
 	return code, nil
 }
 
-func readResponseFromConnection(conn net.Conn) ([]byte, error) {
+// readResponseFromConnection reads until EOF and reports when the first byte arrived.
+func readResponseFromConnection(conn net.Conn) ([]byte, time.Time, error) {
 	temp := make([]byte, 1024)
 	data := make([]byte, 0)
-	length := 0
+	firstByte := time.Time{}
 
 	for {
 		n, err := conn.Read(temp)
+		if n > 0 && firstByte.IsZero() {
+			firstByte = time.Now()
+		}
+		countReceived(n)
+		data = append(data, temp[:n]...)
 		if err != nil {
 			if err != io.EOF {
-				return nil, err
+				return nil, firstByte, err
 			}
 			break
 		}
-
-		data = append(data, temp[:n]...)
-		length += n
 	}
 
-	return data, nil
+	if firstByte.IsZero() {
+		firstByte = time.Now()
+	}
+	return data, firstByte, nil
 }
 
-func udpConnectHandler(inputUrl string, headers RequestHeader) (*url.URL, string, *net.UDPConn, error) {
-	parsedURL, urlErr := url.Parse(inputUrl)
-	parsedHeaders := stringifyHeaders(headers)
+// BytesReceived is the number of bytes read from the network by every request
+// so far. It is meant to be polled for progress reporting.
+func BytesReceived() int64 {
+	return atomic.LoadInt64(&bytesReceived)
+}
 
-	if urlErr != nil {
-		fmt.Println(urlErr)
+func countReceived(n int) {
+	if n > 0 {
+		atomic.AddInt64(&bytesReceived, int64(n))
 	}
+}
 
-	host := fmt.Sprintf("%s:%s", RouterAddr, RouterPort)
-	hostUdpAddr, err := net.ResolveUDPAddr("udp", host)
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
 	if err != nil {
-		fmt.Println(err)
+		return BlankString
 	}
-	conn, err := net.DialUDP("udp", nil, hostUdpAddr)
+	return host
+}
 
-	return parsedURL, parsedHeaders, conn, err
+func udpConnectHandler(inputUrl string, headers RequestHeader) (*url.URL, string, net.Conn, error) {
+	return connect(inputUrl, headers, func(address string) (net.Conn, error) {
+		conn, err := dialer("udp", address, requestTimeout)
+		if err != nil || udpStatsHandler == nil {
+			return conn, err
+		}
+		if udpConn, ok := conn.(*rudp.Conn); ok {
+			return &statsConn{Conn: udpConn, address: address, handler: udpStatsHandler}, nil
+		}
+		return conn, nil
+	})
+}
+
+// statsConn reports the statistics of a UDP connection when it is closed.
+type statsConn struct {
+	*rudp.Conn
+	address string
+	handler func(address string, stats rudp.Stats)
+}
+
+func (conn *statsConn) Close() error {
+	err := conn.Conn.Close()
+	conn.handler(conn.address, conn.Conn.Stats())
+	return err
 }
 
 func connectHandler(inputUrl string, headers RequestHeader) (*url.URL, string, net.Conn, error) {
+	return connect(inputUrl, headers, func(address string) (net.Conn, error) {
+		return dialer("tcp", address, requestTimeout)
+	})
+}
+
+// connect opens a connection to the host of the URL with dial and adds the
+// Host header.
+func connect(inputUrl string, headers RequestHeader, dial func(address string) (net.Conn, error)) (*url.URL, string, net.Conn, error) {
 	parsedURL, urlErr := url.Parse(inputUrl)
 	parsedHeaders := stringifyHeaders(headers)
 
@@ -576,10 +433,28 @@ func connectHandler(inputUrl string, headers RequestHeader) (*url.URL, string, n
 		port = "80"
 	}
 
-	host := fmt.Sprintf("%s:%s", parsedURL.Hostname(), port)
+	host := net.JoinHostPort(parsedURL.Hostname(), port)
+	if !hasHeader(headers, "Host") {
+		parsedHeaders = fmt.Sprintf("Host:%s%s", parsedURL.Host, CRLF) + parsedHeaders
+	}
+
+	conn, err := dial(host)
+	if err != nil {
+		return parsedURL, parsedHeaders, nil, err
+	}
+	if requestTimeout > 0 {
+		err = conn.SetDeadline(time.Now().Add(requestTimeout))
+	}
+	return parsedURL, parsedHeaders, throttle(conn), err
+}
 
-	conn, err := net.Dial("tcp", host)
-	return parsedURL, parsedHeaders, conn, err
+func hasHeader(headers RequestHeader, key string) bool {
+	for headerKey := range headers {
+		if strings.EqualFold(headerKey, key) {
+			return true
+		}
+	}
+	return false
 }
 
 func stringifyHeaders(headers RequestHeader) string {
@@ -589,12 +464,3 @@ func stringifyHeaders(headers RequestHeader) string {
 	}
 	return headersString
 }
-
-func checkNotEmpty(responsePayload []string) bool {
-	for _, packet := range responsePayload {
-		if len(packet) == 0 {
-			return false
-		}
-	}
-	return true
-}
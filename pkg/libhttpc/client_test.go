@@ -0,0 +1,174 @@
+package libhttpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"httpc/pkg/rudp"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleRedirectsReplaysFromCassette(t *testing.T) {
+	interactions := []CassetteInteraction{
+		{
+			Request:  CassetteRequest{Transport: TransportUDP, Method: "GET", URL: "http://example.com/start"},
+			Response: "HTTP/1.0 302 Found\r\nLocation: /next\r\n\r\n",
+		},
+		{
+			Request:  CassetteRequest{Transport: TransportUDP, Method: "GET", URL: "http://example.com/next"},
+			Response: "HTTP/1.0 200 OK\r\nContent-Length: 4\r\n\r\ndone",
+		},
+	}
+	content, err := json.Marshal(interactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	offline := DoerFunc(func(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+		t.Fatalf("%s %s reached the network", method, inputUrl)
+		return BlankString, nil
+	})
+	cassette, err := NewCassette(path, CassetteReplay, offline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetClient(cassette)
+	defer SetClient(nil)
+
+	raw, err := Send(TransportUDP, "GET", "http://example.com/start", RequestHeader{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, _ := FromString(raw)
+	var hops []string
+	raw, err = HandleRedirects(response, raw, TransportUDP, "http://example.com/start", RequestHeader{}, 0, func(statusCode int, location string) {
+		hops = append(hops, location)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, _ = FromString(raw)
+	if response == nil || response.StatusCode != 200 || response.Body != "done" {
+		t.Fatalf("got %q, want the replayed 200", raw)
+	}
+	if len(hops) != 1 || hops[0] != "http://example.com/next" {
+		t.Fatalf("hops = %v", hops)
+	}
+}
+
+func TestHandleRedirectsKeepsCredentialsOnOrigin(t *testing.T) {
+	seen := map[string]RequestHeader{}
+	SetClient(DoerFunc(func(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+		seen[inputUrl] = headers
+		if inputUrl == "http://example.com/start" {
+			return "HTTP/1.0 302 Found\r\nLocation: http://other.example/landing\r\n\r\n", nil
+		}
+		return "HTTP/1.0 200 OK\r\n\r\n", nil
+	}))
+	UseCredentials(HeaderMiddleware(RequestHeader{"X-Token": " secret"}))
+	defer func() {
+		SetClient(nil)
+		ClearMiddleware()
+	}()
+
+	headers := RequestHeader{"Authorization": " Basic dXNlcjpwYXNz", "Host": " example.com", "Accept": " */*"}
+	raw, err := Send(TransportTCP, "GET", "http://example.com/start", headers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 3 {
+		t.Fatalf("Send changed the caller's headers: %v", headers)
+	}
+	response, _ := FromString(raw)
+	if _, err := HandleRedirects(response, raw, TransportTCP, "http://example.com/start", headers, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if seen["http://example.com/start"]["X-Token"] == BlankString {
+		t.Error("the credential middleware did not run for the original origin")
+	}
+	landing := seen["http://other.example/landing"]
+	for _, key := range []string{"Authorization", "Host", "X-Token"} {
+		if _, ok := landing[key]; ok {
+			t.Errorf("%s was sent to another origin", key)
+		}
+	}
+	if landing["Accept"] != " */*" {
+		t.Errorf("Accept = %q on the redirect", landing["Accept"])
+	}
+}
+
+func TestFromStringKeepsBlankLinesInBody(t *testing.T) {
+	body := "--b\r\nContent-Type: text/plain\r\n\r\npart\r\n--b--\r\n\r\ntrailer"
+	response, err := FromString("HTTP/1.1 200 OK\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" + body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response == nil || response.StatusCode != 200 || response.Protocol != "HTTP/1.1" {
+		t.Fatalf("status line not parsed: %+v", response)
+	}
+	if response.Body != body {
+		t.Fatalf("body %q, want %q", response.Body, body)
+	}
+
+	if response, err := FromString("HTTP/1.1 200 OK\r\nContent-Length: 0"); response != nil || err != nil {
+		t.Fatalf("without a blank line: %+v, %v, want nil", response, err)
+	}
+}
+
+// gatedReader holds its content back until open is closed, so a body read
+// before the request is under way times out.
+type gatedReader struct {
+	open    chan bool
+	content io.Reader
+}
+
+func (reader *gatedReader) Read(buffer []byte) (int, error) {
+	select {
+	case <-reader.open:
+		return reader.content.Read(buffer)
+	case <-time.After(5 * time.Second):
+		return 0, errors.New("body read before the request was sent")
+	}
+}
+
+func TestSendStreamStreamsOverUDP(t *testing.T) {
+	listener, err := rudp.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := &gatedReader{open: make(chan bool), content: strings.NewReader(strings.Repeat("x", 5000))}
+	server := &http.Server{Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// the headers arrived before any of the body was read
+		close(body.open)
+		received, _ := ioutil.ReadAll(request.Body)
+		fmt.Fprintf(writer, "%d", len(received))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	SetDialer(func(network string, address string, timeout time.Duration) (net.Conn, error) {
+		return (&rudp.Dialer{Timeout: timeout}).Dial(network, address)
+	})
+	defer SetDialer(nil)
+
+	raw, err := SendStream(TransportUDP, "POST", "http://"+listener.Addr().String()+"/upload", RequestHeader{}, body, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, _ := FromString(raw)
+	if response == nil || response.StatusCode != 200 || response.Body != "5000" {
+		t.Fatalf("got %q, want the whole body received", raw)
+	}
+}
@@ -0,0 +1,204 @@
+package libhttpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"httpc/pkg/rudp"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Config is the content of ~/.config/httpc/config. The default section
+// applies to every invocation and a profile selected with --profile is
+// layered on top of it.
+type Config struct {
+	Default  Profile            `json:"default"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+type Profile struct {
+	Headers   map[string]string `json:"headers"`
+	BaseURL   string            `json:"base_url"`
+	Transport string            `json:"transport"`
+	Router    string            `json:"router"`
+	Timeout   string            `json:"timeout"`
+	Auth      *Auth             `json:"auth"`
+}
+
+// Auth is either basic (username/password) or bearer (token) authentication.
+type Auth struct {
+	Type     string `json:"type"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+}
+
+const ConfigEnvVar = "HTTPC_CONFIG"
+
+var routerAddr = RouterAddr
+var routerPort = RouterPort
+var requestTimeout time.Duration
+var udpWindow int
+var udpStatsHandler func(address string, stats rudp.Stats)
+var udpCongestion func() rudp.CongestionControl
+var udpTrace *rudp.Trace
+
+var schemePattern = regexp.MustCompile("^http(s?)://")
+
+// DefaultConfigPath returns $HTTPC_CONFIG, or ~/.config/httpc/config.
+func DefaultConfigPath() string {
+	if path := os.Getenv(ConfigEnvVar); path != BlankString {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return BlankString
+	}
+	return filepath.Join(home, ".config", "httpc", "config")
+}
+
+// LoadConfig reads the config at path. A missing file yields an empty config.
+func LoadConfig(path string) (*Config, error) {
+	config := Config{Profiles: map[string]Profile{}}
+	if path == BlankString {
+		return &config, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("Invalid config file %s: %s", path, err.Error())
+	}
+	return &config, nil
+}
+
+// Profile merges the named profile over the default section. An empty name
+// returns the default section alone.
+func (config *Config) Profile(name string) (*Profile, error) {
+	merged := Profile{Headers: map[string]string{}}
+	merged.merge(config.Default)
+
+	if name != BlankString {
+		profile, ok := config.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown profile '%s'", name)
+		}
+		merged.merge(profile)
+	}
+	return &merged, nil
+}
+
+func (profile *Profile) merge(other Profile) {
+	for key, value := range other.Headers {
+		profile.Headers[key] = value
+	}
+	if other.BaseURL != BlankString {
+		profile.BaseURL = other.BaseURL
+	}
+	if other.Transport != BlankString {
+		profile.Transport = other.Transport
+	}
+	if other.Router != BlankString {
+		profile.Router = other.Router
+	}
+	if other.Timeout != BlankString {
+		profile.Timeout = other.Timeout
+	}
+	if other.Auth != nil {
+		profile.Auth = other.Auth
+	}
+}
+
+// ApplyHeaders adds the profile headers and auth to headers without
+// replacing any header that is already set, in whatever case.
+func (profile *Profile) ApplyHeaders(headers RequestHeader) {
+	for key, value := range profile.Headers {
+		if !hasHeader(headers, key) {
+			headers[key] = value
+		}
+	}
+	if !hasHeader(headers, "Authorization") && profile.Auth != nil {
+		if authorization := profile.Auth.header(); authorization != BlankString {
+			headers["Authorization"] = authorization
+		}
+	}
+}
+
+// ResolveURL joins a relative URL onto the profile's base URL.
+func (profile *Profile) ResolveURL(inputUrl string) string {
+	if schemePattern.MatchString(inputUrl) || profile.BaseURL == BlankString {
+		return inputUrl
+	}
+	return strings.TrimSuffix(profile.BaseURL, "/") + "/" + strings.TrimPrefix(inputUrl, "/")
+}
+
+// TimeoutDuration parses the profile timeout; an unset timeout is zero.
+func (profile *Profile) TimeoutDuration() (time.Duration, error) {
+	if profile.Timeout == BlankString {
+		return 0, nil
+	}
+	return time.ParseDuration(profile.Timeout)
+}
+
+func (auth *Auth) header() string {
+	switch strings.ToLower(auth.Type) {
+	case "basic":
+		credentials := auth.Username + ":" + auth.Password
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	case "bearer":
+		return "Bearer " + auth.Token
+	}
+	return BlankString
+}
+
+// SetRouter changes the router used by the UDP transport, given as host:port.
+func SetRouter(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	routerAddr = host
+	routerPort = port
+	return nil
+}
+
+// SetTimeout bounds every following request; zero disables the timeout.
+func SetTimeout(timeout time.Duration) {
+	requestTimeout = timeout
+}
+
+// SetUDPStatsHandler has handler called with the round-trip time statistics
+// of every UDP connection once it is closed. nil disables it.
+func SetUDPStatsHandler(handler func(address string, stats rudp.Stats)) {
+	udpStatsHandler = handler
+}
+
+// SetCongestion selects the congestion control of the UDP transport, eg.
+// rudp.NewCubic; nil restores Reno.
+func SetCongestion(congestion func() rudp.CongestionControl) {
+	udpCongestion = congestion
+}
+
+// SetCwndTrace has the congestion window of every UDP connection written to
+// trace. nil disables it.
+func SetCwndTrace(trace *rudp.Trace) {
+	udpTrace = trace
+}
+
+// SetWindow sets the send window of the UDP transport in packets; zero
+// restores the default.
+func SetWindow(window int) {
+	udpWindow = window
+}
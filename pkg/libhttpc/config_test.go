@@ -0,0 +1,40 @@
+package libhttpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyHeadersKeepsCommandLineHeaders(t *testing.T) {
+	profile := &Profile{
+		Headers: map[string]string{"Accept": "application/json", "X-Team": "core"},
+		Auth:    &Auth{Type: "bearer", Token: "profile-token"},
+	}
+	cases := []struct {
+		name    string
+		headers RequestHeader
+		want    RequestHeader
+	}{
+		{
+			"profile fills in",
+			RequestHeader{},
+			RequestHeader{"Accept": "application/json", "X-Team": "core", "Authorization": "Bearer profile-token"},
+		},
+		{
+			"command line wins",
+			RequestHeader{"Accept": " text/plain", "Authorization": " Basic dXNlcjpwYXNz"},
+			RequestHeader{"Accept": " text/plain", "X-Team": "core", "Authorization": " Basic dXNlcjpwYXNz"},
+		},
+		{
+			"in any case",
+			RequestHeader{"accept": " text/plain", "authorization": " Bearer cli-token", "X-TEAM": " other"},
+			RequestHeader{"accept": " text/plain", "authorization": " Bearer cli-token", "X-TEAM": " other"},
+		},
+	}
+	for _, c := range cases {
+		profile.ApplyHeaders(c.headers)
+		if !reflect.DeepEqual(c.headers, c.want) {
+			t.Errorf("%s:\n got %v\nwant %v", c.name, c.headers, c.want)
+		}
+	}
+}
@@ -9,16 +9,15 @@ type Response struct {
 	Body       string
 }
 
-type UDPPacket struct {
-	pType    []byte
-	seqNo    []byte
-	peerAddr []byte
-	peerPort []byte
-	payload  []byte
-}
-
 const ProtocolVersion = "HTTP/1.0"
 
+var bytesReceived int64
+
+const (
+	TransportTCP = "tcp"
+	TransportUDP = "udp"
+)
+
 const CRLF = "\r\n"
 
 const BlankString = ""
@@ -34,35 +33,339 @@ get executes a HTTP GET request and prints the response.
 
 post executes a HTTP POST request and prints the response.
 
+run executes the requests of a .http file and prints a summary.
+
+bench generates load against a URL and reports throughput and latency.
+
+test runs the cases of a YAML spec and writes the results as JUnit XML.
+
+ws connects to a WebSocket endpoint and bridges it with stdin and stdout.
+
+sse prints the events of a Server-Sent Events stream as they arrive.
+
+from-curl runs or prints the httpc equivalent of a curl command.
+
+shell starts an interactive session with a base URL, headers, cookies and history.
+
 help prints this screen.
 
 Use "httpc help [command]" for more information about a command.`
 
-const HelpTextGet = `usage: httpc get [-v] [-h key:value] URL
+const HelpTextGet = `usage: httpc get [-v] [-h key:value] [-o file]... [-O] [--create-dirs] [--no-clobber] [--parallel-max N] [--globoff] [--jq path] [--pretty auto|always|never] [--color auto|always|never] [--har file] [--export go|curl] [--profile name] [--transport udp|tcp] [--router host:port] [--timeout D] URL
 
-Get executes a HTTP GET request for a given URL.
+Get executes a HTTP GET request for each given URL. A URL may be a pattern such as
+'file[1-100].txt', 'file[001-100].txt', 'img[a-z].png' or '{one,two}.html'.
  -v Prints the detail of the response such as protocol, status, and headers.
- -h key:value Associates headers to HTTP Request with the format 'key:value'.`
+ -h key:value Associates headers to HTTP Request with the format 'key:value'.
+ -o Writes the response out to a file. Repeat it once per URL; '#1', '#2', ...
+    in the name are replaced with the values of the URL's patterns.
+ -O Writes every response without -o to a file named after the Content-Disposition header or the URL.
+ --create-dirs Creates the missing directories of the output file.
+ --no-clobber Keeps an existing output file and writes to file.1, file.2, ... instead.
+ --parallel-max N Fetches up to N URLs concurrently. Default is 1.
+ --globoff Treats '[]{}' in URLs literally.
+` + helpTextFormat + `
+ --har file Records every exchange, redirects included, into a HAR 1.2 file.
+ --export go|curl Prints a Go program using libhttpc or a curl command for every request made.
+` + helpTextCommon
 
-const HelpTextPost = `usage: httpc post [-v] [-h key:value] [-d inline-data] [-f file] URL
+const HelpTextPost = `usage: httpc post [-v] [-h key:value] [-d inline-data] [--data-binary data] [-f file] [-F name=value]... [-o file | -O] [--create-dirs] [--no-clobber] [--jq path] [--pretty auto|always|never] [--color auto|always|never] [--har file] [--export go|curl] [--profile name] [--transport udp|tcp] [--router host:port] [--timeout D] URL
 
 Post executes a HTTP POST request for a given URL with inline data or from file.
  -v Prints the detail of the response such as protocol, status, and headers.
  -h key:value Associates headers to HTTP Request with the format 'key:value'.
  -d string Associates an inline data to the body HTTP POST request.
- -f file Associates the content of a file to the body HTTP POST request.
+    '-d @file' reads the body from a file and '-d @-' from stdin, with newlines stripped.
+ --data-binary string Like -d, but '@file' and '@-' send the bytes unchanged.
+ -f file Associates the content of a file to the body HTTP POST request. Use '-' for stdin.
+ -F name=value Adds a multipart/form-data field; 'name=@file' attaches a file. Repeatable.
  -o Writes the response out to a file.
+ -O Writes the response to a file named after the Content-Disposition header or the URL.
+ --create-dirs Creates the missing directories of the output file.
+ --no-clobber Keeps an existing output file and writes to file.1, file.2, ... instead.
+` + helpTextFormat + `
+ --har file Records every exchange into a HAR 1.2 file.
+ --export go|curl Prints a Go program using libhttpc or a curl command for the request made.
+` + helpTextCommon + `
+
+Only one of [-d], [--data-binary], [-f] or [-F] can be used.`
+
+const HelpTextFromCurl = `usage: httpc from-curl [--print] 'curl command'
+
+From-curl translates a curl command into httpc flags and runs it over the TCP
+transport. The command may be given as one quoted argument or as separate words.
+Understood curl options are -X, -H, -d, --data-raw, --data-binary, --data-urlencode,
+-F, -u, -A, -e, -b, -G, -L, -o, -O, -i, -v, -m, --limit-rate, --unix-socket, --resolve
+and --connect-to. -L, -s and -S are accepted as httpc already follows redirects and
+shows no progress meter; -k, -f and --compressed have no equivalent and are reported
+on stderr when dropped. Only GET and POST requests can be translated.
+ --print Prints the httpc command instead of running it.`
+
+const HelpTextRun = `usage: httpc run [-v] [--parallel N] [--har file] [--profile name] [--transport udp|tcp] [--router host:port] [--timeout D] file.http
+
+Run executes the requests of a .http file (VS Code REST Client / JetBrains format).
+Requests are separated by '###', named with '# @name', and may use file variables
+'@key = value', '{{$processEnv NAME}}' and values captured from earlier responses
+such as '{{login.response.body.$.token}}' or '{{login.response.headers.Location}}'.
+ -v Prints every response.
+ --parallel N Executes up to N requests concurrently. Default is 1.
+ --har file Records every exchange into a HAR 1.2 file.
+` + helpTextCommon
+
+const HelpTextBench = `usage: httpc bench [-n requests] [-c concurrency] [--rate N] [--duration D] [-m method] [-h key:value] [-d inline-data] [--json] [--profile name] [--transport udp|tcp] [--router host:port] [--timeout D] URL
+
+Bench sends requests to a URL from concurrent workers and reports throughput,
+an error breakdown and p50/p90/p99/max latencies.
+ -n Number of requests to send. Default is 200, or unlimited when --duration is set.
+ -c Number of concurrent workers. Default is 10.
+ --rate Caps the total request rate in requests per second. Default is unlimited.
+ --duration Stops sending after the duration (eg. 10s, 1m).
+ -m HTTP method to use. Default is GET.
+ -h key:value Associates headers to HTTP Request with the format 'key:value'.
+ -d string Associates an inline data to the body of every request.
+ --json Prints the report as JSON.
+` + helpTextCommon
+
+const helpTextFormat = ` --jq path Prints the value at a JSONPath such as '.items[0].name' instead of the body.
+ --pretty auto|always|never Indents JSON, XML and HTML bodies written to stdout. Default is auto, on a terminal.
+ --color auto|always|never Colours pretty output. Default is auto, on a terminal unless NO_COLOR is set.
+ Text bodies (text/*, JSON, XML or with a charset) written to a terminal are transcoded to UTF-8
+ from the charset of the Content-Type, a byte order mark or a <meta> declaration; pipes and
+ files get the bytes as received.`
+
+const helpTextCommon = ` --profile name Uses the named profile of the config file ($HTTPC_CONFIG or ~/.config/httpc/config).
+ --transport Selects the transport, either udp or tcp. Default is udp.
+ --router host:port Router used by the UDP transport. Default is 127.0.0.1:3000.
+ --timeout D Gives up on a request after the duration (eg. 5s).
+ --window N Packets the UDP transport sends ahead of the oldest unacknowledged one. Default is 64.
+ --congestion reno|cubic|none Congestion control of the UDP transport. Default is reno, none
+    sends a full window regardless of losses.
+ --cwnd-trace file Writes the congestion window, slow start threshold, packets in flight, smoothed
+    round-trip time and retransmission timeout of every UDP connection to the CSV file.
+ --rudp-stats Prints the smoothed round-trip time, its variation, the retransmission timeout and
+    the retransmissions of every UDP connection to stderr.
+ --limit-rate R Caps transfers to R bytes per second, with K, M or G suffixes (eg. 100K).
+ --unix-socket path Sends requests over the Unix domain socket at path. Needs --transport tcp.
+ --resolve host:port:addr Connects to addr instead of resolving host for that port. Repeatable.
+ --connect-to h1:p1:h2:p2 Connects to h2:p2 for requests to h1:p1, empty parts match anything. Repeatable.
+ --user-agent UA Sends the User-Agent header with every request that has none.
+ --request-id Gives every request a random X-Request-Id header.
+ --log-requests Logs every request with its status and duration to stderr.
+ --oauth2-token-url URL Sends 'Authorization: Bearer' with a token from the OAuth2 endpoint, cached
+    until it expires and renewed when a request gets 401. Uses the client_credentials grant,
+    or refresh_token with --oauth2-refresh-token.
+ --oauth2-client-id id, --oauth2-client-secret secret Client credentials for the token endpoint.
+ --oauth2-scope scope Scopes to request, space separated.
+ --oauth2-refresh-token token Refresh token to get the first access token with.
+ --sign hmac:keyid:secret Signs every request with HMAC-SHA256 over method, path, query,
+    Host, Date, Content-Type and the body hash, in an Authorization header.
+ --aws-sigv4 provider:region:service Signs every request with AWS Signature Version 4 (eg.
+    aws:us-east-1:s3), with the credentials of AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+    and AWS_SESSION_TOKEN.
+ --cassette file Records exchanges to the JSON cassette file and replays them from it.
+ --cassette-mode record|replay|auto Replay never uses the network, record always does. Default is auto,
+    which replays what the cassette has and records the rest.
+ --match list Fields a recorded request must share to be replayed: method, url, body and
+    headers, or headers:Name:Name for some of them. Default is method,url.
 
-Either [-d] or [-f] can be used but not both.`
+Flags override the profile, which overrides the default section of the config file.`
+
+const HelpTextShell = `usage: httpc shell [-h key:value] [--profile name] [--transport udp|tcp] [--router host:port] [--timeout D] [base URL]
+
+Shell starts an interactive session reading one command per line. The session
+keeps a base URL, headers sent with every request, the cookies servers set and
+a history of requests and responses. Type 'help' in the shell for its commands.
+ -h key:value Adds a session header with the format 'key:value'.
+
+The base URL defaults to the profile's base_url.`
+
+const HelpTextShellCommands = `get|post|put|patch|delete|head|options PATH [BODY]
+    Sends a request to PATH, resolved against the base URL. A BODY starting
+    with '{' or '[' is sent as application/json.
+base [URL]          Prints or sets the base URL.
+header Name: value  Sends the header with every request.
+unheader Name       Stops sending the header.
+headers             Lists the session headers.
+cookies [clear]     Lists or clears the cookie jar.
+verbose [on|off]    Prints protocol, status and headers of responses.
+transport udp|tcp   Switches the transport.
+history             Lists the requests sent so far.
+show [N]            Prints the response of request N, default the last one.
+rerun [N]           Sends request N again, default the last one.
+save FILE [N...]    Writes the history, or requests N..., to a .http file.
+exit                Ends the session.`
+
+const HelpTextTest = `usage: httpc test [--junit file] [--profile name] [--transport udp|tcp] [--router host:port] [--timeout D] spec.yaml
+
+Test sends the request of every case in a YAML spec and checks its expectations.
+A summary is printed and the results are written as JUnit XML. The exit status is
+1 when a case fails.
+
+  name: smoke                  # suite name, defaults to the file name
+  base_url: http://localhost:8080
+  transport: tcp               # overridden by --transport
+  headers: {Accept: application/json}
+  cases:
+    - name: list users
+      request:
+        method: GET            # default GET
+        url: /users
+        headers: {X-Trace: "1"}
+        body: ""
+      expect:
+        status: 200
+        headers: {Content-Type: application/json}
+        body: '"users"'        # regular expression
+        json:
+          $.users[0].name: alice
+          $.count: 3
+        max_latency: 500ms
+
+ --junit file Writes the JUnit XML report to file. Default is junit.xml, '' disables it.
+` + helpTextCommon
+
+const HelpTextWs = `usage: httpc ws [-v] [-h key:value] [--binary] [--ping D] [--profile name] [--timeout D] URL
+
+Ws performs the WebSocket (RFC 6455) handshake with a ws:// or wss:// URL. Every line
+read from stdin is sent as a message and every message received is printed on its
+own line. The connection is closed once stdin ends.
+ -v Prints connection, ping/pong and close events to stderr.
+ -h key:value Associates headers to the Upgrade request with the format 'key:value'.
+ --binary Sends stdin lines as binary messages instead of text.
+ --ping D Sends a ping every D (eg. 30s).
+ --limit-rate, --unix-socket, --resolve and --connect-to work as for get, and --user-agent,
+    --request-id, --sign, --aws-sigv4 and --oauth2-* add their headers to the Upgrade request.
+    The connection is always over TCP.`
+
+const HelpTextSse = `usage: httpc sse [-v | --json] [-h key:value] [--last-event-id id] [-n count] [--profile name] [--timeout D] URL
+
+Sse subscribes to a text/event-stream and prints the data of every event as it
+arrives. Dropped connections are re-established with the Last-Event-ID header
+after the server's retry delay (3s by default, at least 100ms), doubled for every
+reconnect that brings no event; sse gives up after 8 of those in a row.
+ -v Prints the id, event type and data of every event.
+ --json Prints every event as a JSON object on its own line.
+ -h key:value Associates headers to HTTP Request with the format 'key:value'.
+ --last-event-id id Resumes the stream after the given event id.
+ -n count Exits after receiving count events.
+ --limit-rate, --unix-socket, --resolve and --connect-to work as for get, and --user-agent,
+    --request-id, --sign, --aws-sigv4 and --oauth2-* add their headers to every request of
+    the stream. The connection is always over TCP.`
 
 const HelpTextVerbose = `Prints the detail of the response such as protocol, status, and headers.`
 
 const HelpTextData = `Associates an inline data to the body HTTP POST request.`
 
+const HelpTextDataBinary = `Associates data to the body HTTP POST request without stripping newlines; '@file' or '@-' reads a file or stdin.`
+
 const HelpTextFile = `Associates the content of a file to the body HTTP POST request.`
 
 const HelpTextHeader = `Associates headers to HTTP Request with the format 'key:value'.`
 
+const HelpTextParallel = `Executes up to N requests concurrently.`
+
+const HelpTextTransport = `Selects the transport used for requests, either udp or tcp.`
+
+const HelpTextBenchRequests = `Number of requests to send.`
+
+const HelpTextBenchConcurrency = `Number of concurrent workers.`
+
+const HelpTextBenchRate = `Caps the total request rate in requests per second.`
+
+const HelpTextBenchDuration = `Stops sending requests after the duration.`
+
+const HelpTextBenchMethod = `HTTP method to use.`
+
+const HelpTextBenchJSON = `Prints the report as JSON.`
+
+const HelpTextProfile = `Uses the named profile of the config file.`
+
+const HelpTextRouter = `Router used by the UDP transport, as host:port.`
+
+const HelpTextTimeout = `Gives up on a request after the duration.`
+
+const HelpTextWindow = `Packets the UDP transport sends ahead of the oldest unacknowledged one.`
+
+const HelpTextCongestion = `Congestion control of the UDP transport: reno, cubic or none.`
+
+const HelpTextCwndTrace = `Writes the congestion window of every UDP connection to the CSV file.`
+
+const HelpTextRudpStats = `Prints the round-trip time and retransmission statistics of every UDP connection to stderr.`
+
+const HelpTextLimitRate = `Caps transfers to the given bytes per second, with K, M or G suffixes.`
+
+const HelpTextUnixSocket = `Sends TCP requests over the Unix domain socket at the given path. Needs --transport tcp.`
+
+const HelpTextResolve = `Connects to addr for requests to host:port, as host:port:addr.`
+
+const HelpTextConnectTo = `Connects to HOST2:PORT2 for requests to HOST1:PORT1, as HOST1:PORT1:HOST2:PORT2.`
+
+const HelpTextUserAgent = `Sends the User-Agent header with every request that has none.`
+
+const HelpTextRequestID = `Gives every request a random X-Request-Id header.`
+
+const HelpTextLogRequests = `Logs every request with its status and duration to stderr.`
+
+const HelpTextOAuth2TokenURL = `OAuth2 token endpoint to get bearer tokens from.`
+
+const HelpTextOAuth2ClientID = `OAuth2 client id.`
+
+const HelpTextOAuth2ClientSecret = `OAuth2 client secret.`
+
+const HelpTextOAuth2Scope = `OAuth2 scopes to request, space separated.`
+
+const HelpTextOAuth2RefreshToken = `OAuth2 refresh token to get the first access token with.`
+
+const HelpTextSign = `Signs every request with HMAC-SHA256, as hmac:keyid:secret.`
+
+const HelpTextAwsSigV4 = `Signs every request with AWS Signature Version 4, as provider:region:service.`
+
+const HelpTextCassette = `Records exchanges to the given JSON cassette file and replays them from it.`
+
+const HelpTextCassetteMode = `Cassette mode: record, replay or auto.`
+
+const HelpTextMatch = `Fields a recorded request must share to be replayed, eg. method,url,body or headers:Accept.`
+
+const HelpTextRemoteName = `Writes the response to a file named after the Content-Disposition header or the URL.`
+
+const HelpTextCreateDirs = `Creates the missing directories of the output file.`
+
+const HelpTextNoClobber = `Keeps an existing output file and writes to a numbered file name instead.`
+
+const HelpTextParallelMax = `Fetches up to N URLs concurrently.`
+
+const HelpTextGlobOff = `Treats '[]{}' in URLs literally.`
+
+const HelpTextWsVerbose = `Prints connection, ping/pong and close events to stderr.`
+
+const HelpTextWsBinary = `Sends stdin lines as binary messages instead of text.`
+
+const HelpTextWsPing = `Sends a ping at the given interval.`
+
+const HelpTextSseVerbose = `Prints the id, event type and data of every event.`
+
+const HelpTextSseJSON = `Prints every event as a JSON object on its own line.`
+
+const HelpTextSseLastEventID = `Resumes the stream after the given event id.`
+
+const HelpTextSseCount = `Exits after receiving the given number of events.`
+
+const HelpTextExport = `Prints a Go program using libhttpc or a curl command reproducing the request, either go or curl.`
+
+const HelpTextForm = `Adds a multipart/form-data field as 'name=value', or a file as 'name=@file'.`
+
+const HelpTextFromCurlPrint = `Prints the httpc command instead of running it.`
+
+const HelpTextJUnit = `Writes the JUnit XML report to the given file, '' disables it.`
+
+const HelpTextJq = `Prints the value at a JSONPath such as '.items[0].name' instead of the body.`
+
+const HelpTextPretty = `Indents JSON, XML and HTML bodies written to stdout: auto, always or never.`
+
+const HelpTextColor = `Colours pretty output: auto, always or never.`
+
+const HelpTextHAR = `Records every exchange, redirects included, into a HAR 1.2 file.`
+
 const HelpTextOutput = `Writes the response of the HTTP request to a file.`
 
 const DefaultRedirectURI = "http://google.com"
@@ -0,0 +1,216 @@
+package libhttpc
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie is one cookie stored from a Set-Cookie header (RFC 6265). An empty
+// Expires means a session cookie.
+type Cookie struct {
+	Name     string
+	Value    string
+	Domain   string
+	Path     string
+	Expires  time.Time
+	Secure   bool
+	HostOnly bool
+}
+
+// CookieJar keeps the cookies servers set and sends them back on matching
+// requests.
+type CookieJar struct {
+	mutex   sync.Mutex
+	cookies []*Cookie
+}
+
+func NewCookieJar() *CookieJar {
+	return &CookieJar{}
+}
+
+// Update stores the cookies a response sets. Cookies with a past expiry
+// delete the stored cookie of the same name, domain and path.
+func (jar *CookieJar) Update(requestURL string, response *Response) {
+	parsedURL, err := url.Parse(requestURL)
+	if err != nil || response == nil {
+		return
+	}
+
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	for _, header := range response.HeaderValues("Set-Cookie") {
+		cookie, err := ParseSetCookie(header, parsedURL)
+		if err != nil {
+			continue
+		}
+		kept := jar.cookies[:0]
+		for _, stored := range jar.cookies {
+			if stored.Name != cookie.Name || stored.Domain != cookie.Domain || stored.Path != cookie.Path {
+				kept = append(kept, stored)
+			}
+		}
+		jar.cookies = kept
+		if cookie.Expires.IsZero() || cookie.Expires.After(time.Now()) {
+			jar.cookies = append(jar.cookies, cookie)
+		}
+	}
+}
+
+// Header builds the Cookie header for a request, longest paths first as
+// RFC 6265 recommends. It is empty when no cookie matches.
+func (jar *CookieJar) Header(requestURL string) string {
+	parsedURL, err := url.Parse(requestURL)
+	if err != nil {
+		return BlankString
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+	path := parsedURL.EscapedPath()
+	if path == BlankString {
+		path = "/"
+	}
+
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	var matching []*Cookie
+	now := time.Now()
+	for _, cookie := range jar.cookies {
+		if !cookie.Expires.IsZero() && cookie.Expires.Before(now) {
+			continue
+		}
+		if cookie.Secure && parsedURL.Scheme != "https" && parsedURL.Scheme != "wss" {
+			continue
+		}
+		if !cookieDomainMatches(cookie, host) || !cookiePathMatches(cookie.Path, path) {
+			continue
+		}
+		matching = append(matching, cookie)
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return len(matching[i].Path) > len(matching[j].Path)
+	})
+
+	pairs := make([]string, len(matching))
+	for i, cookie := range matching {
+		pairs[i] = cookie.Name + "=" + cookie.Value
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// Cookies returns a copy of the unexpired cookies.
+func (jar *CookieJar) Cookies() []Cookie {
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	cookies := []Cookie{}
+	for _, cookie := range jar.cookies {
+		if cookie.Expires.IsZero() || cookie.Expires.After(time.Now()) {
+			cookies = append(cookies, *cookie)
+		}
+	}
+	return cookies
+}
+
+func (jar *CookieJar) Clear() {
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	jar.cookies = nil
+}
+
+// ParseSetCookie parses a Set-Cookie header value received for requestURL.
+// Domains the request host is not part of are rejected.
+func ParseSetCookie(header string, requestURL *url.URL) (*Cookie, error) {
+	parts := strings.Split(header, ";")
+	nameValue := strings.SplitN(parts[0], "=", 2)
+	if len(nameValue) != 2 || strings.TrimSpace(nameValue[0]) == BlankString {
+		return nil, fmt.Errorf("Malformed Set-Cookie '%s'", header)
+	}
+
+	host := strings.ToLower(requestURL.Hostname())
+	cookie := &Cookie{
+		Name:     strings.TrimSpace(nameValue[0]),
+		Value:    strings.Trim(strings.TrimSpace(nameValue[1]), `"`),
+		Domain:   host,
+		Path:     defaultCookiePath(requestURL.EscapedPath()),
+		HostOnly: true,
+	}
+
+	maxAgeSet := false
+	for _, attribute := range parts[1:] {
+		keyValue := strings.SplitN(attribute, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(keyValue[0]))
+		value := BlankString
+		if len(keyValue) == 2 {
+			value = strings.TrimSpace(keyValue[1])
+		}
+
+		switch key {
+		case "domain":
+			domain := strings.ToLower(strings.TrimPrefix(value, "."))
+			if domain == BlankString {
+				continue
+			}
+			if host != domain && !strings.HasSuffix(host, "."+domain) {
+				return nil, fmt.Errorf("Cookie domain '%s' does not match host '%s'", domain, host)
+			}
+			cookie.Domain = domain
+			cookie.HostOnly = false
+		case "path":
+			if strings.HasPrefix(value, "/") {
+				cookie.Path = value
+			}
+		case "max-age":
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			maxAgeSet = true
+			if seconds <= 0 {
+				cookie.Expires = time.Unix(1, 0)
+			} else {
+				cookie.Expires = time.Now().Add(time.Duration(seconds) * time.Second)
+			}
+		case "expires":
+			if maxAgeSet {
+				continue
+			}
+			for _, layout := range []string{time.RFC1123, "Mon, 02-Jan-2006 15:04:05 MST", time.RFC850, time.ANSIC} {
+				if expires, err := time.Parse(layout, value); err == nil {
+					cookie.Expires = expires
+					break
+				}
+			}
+		case "secure":
+			cookie.Secure = true
+		}
+	}
+	return cookie, nil
+}
+
+// defaultCookiePath is the directory of the request path.
+func defaultCookiePath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.Count(path, "/") == 1 {
+		return "/"
+	}
+	return path[:strings.LastIndex(path, "/")]
+}
+
+func cookieDomainMatches(cookie *Cookie, host string) bool {
+	if cookie.HostOnly {
+		return host == cookie.Domain
+	}
+	return host == cookie.Domain || strings.HasSuffix(host, "."+cookie.Domain)
+}
+
+func cookiePathMatches(cookiePath string, requestPath string) bool {
+	if requestPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
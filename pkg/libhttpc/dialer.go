@@ -0,0 +1,112 @@
+package libhttpc
+
+import (
+	"fmt"
+	"httpc/pkg/rudp"
+	"net"
+	"strings"
+	"time"
+)
+
+// DialFunc opens the connection a request is sent over. network is "tcp", or
+// "udp" for the UDP transport, and address is the host:port taken from the
+// request URL. DefaultDialer is the default.
+type DialFunc func(network string, address string, timeout time.Duration) (net.Conn, error)
+
+// AddressOverride redirects connections for Host:Port to ToHost:ToPort. An
+// empty Host or Port matches any, an empty ToHost or ToPort keeps the original.
+type AddressOverride struct {
+	Host   string
+	Port   string
+	ToHost string
+	ToPort string
+}
+
+var dialer DialFunc = DefaultDialer
+
+// SetDialer replaces the dialer used for requests, websockets and event
+// streams. nil restores the default.
+func SetDialer(dial DialFunc) {
+	if dial == nil {
+		dial = DefaultDialer
+	}
+	dialer = dial
+}
+
+// DefaultDialer opens UDP connections through the router with the window
+// and congestion control set, their packets paced by the rate limit, and
+// anything else with net.DialTimeout.
+func DefaultDialer(network string, address string, timeout time.Duration) (net.Conn, error) {
+	if network != "udp" {
+		return net.DialTimeout(network, address, timeout)
+	}
+	udpDialer := &rudp.Dialer{
+		Router:     net.JoinHostPort(routerAddr, routerPort),
+		Timeout:    timeout,
+		Window:     udpWindow,
+		Congestion: udpCongestion,
+		Trace:      udpTrace,
+	}
+	if rateLimiter != nil {
+		udpDialer.Pace = rateLimiter.Wait
+	}
+	return udpDialer.Dial(network, address)
+}
+
+// UnixSocketDialer sends every request over the Unix domain socket at path,
+// whatever host the URL names.
+func UnixSocketDialer(path string) DialFunc {
+	return func(network string, address string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", path, timeout)
+	}
+}
+
+// OverrideDialer applies the first matching override before calling next.
+func OverrideDialer(next DialFunc, overrides []AddressOverride) DialFunc {
+	return func(network string, address string, timeout time.Duration) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		for _, override := range overrides {
+			if override.Host != BlankString && !strings.EqualFold(override.Host, host) {
+				continue
+			}
+			if override.Port != BlankString && override.Port != port {
+				continue
+			}
+			if override.ToHost != BlankString {
+				host = override.ToHost
+			}
+			if override.ToPort != BlankString {
+				port = override.ToPort
+			}
+			break
+		}
+		return next(network, net.JoinHostPort(host, port), timeout)
+	}
+}
+
+// ParseResolve parses curl's '--resolve host:port:addr'. addr may be a
+// bracketed IPv6 address.
+func ParseResolve(spec string) (AddressOverride, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || parts[0] == BlankString || parts[1] == BlankString || parts[2] == BlankString {
+		return AddressOverride{}, fmt.Errorf("Invalid --resolve '%s', expected host:port:addr", spec)
+	}
+	return AddressOverride{
+		Host:   parts[0],
+		Port:   parts[1],
+		ToHost: strings.Trim(parts[2], "[]"),
+	}, nil
+}
+
+// ParseConnectTo parses curl's '--connect-to HOST1:PORT1:HOST2:PORT2' where
+// any part may be left empty.
+func ParseConnectTo(spec string) (AddressOverride, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 4 {
+		return AddressOverride{}, fmt.Errorf("Invalid --connect-to '%s', expected HOST1:PORT1:HOST2:PORT2", spec)
+	}
+	return AddressOverride{Host: parts[0], Port: parts[1], ToHost: parts[2], ToPort: parts[3]}, nil
+}
@@ -0,0 +1,99 @@
+package libhttpc
+
+import "sync"
+
+// Doer sends one request and returns the raw response. Client implements it
+// over the real transports; code embedding libhttpc can take a Doer and be
+// given a Cassette or a fake in its tests.
+type Doer interface {
+	Send(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error)
+}
+
+// Client is the Doer dialing real sockets.
+type Client struct{}
+
+func (Client) Send(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	return send(transport, method, inputUrl, headers, body)
+}
+
+// DoerFunc lets a plain function be used as a Doer.
+type DoerFunc func(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error)
+
+func (doer DoerFunc) Send(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+	return doer(transport, method, inputUrl, headers, body)
+}
+
+var client Doer = Client{}
+var middlewares []Middleware
+var credentials []Middleware
+var clientMutex sync.Mutex
+
+// SetClient makes Send, and everything built on it, go through doer. nil
+// restores the default Client.
+func SetClient(doer Doer) {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	if doer == nil {
+		doer = Client{}
+	}
+	client = doer
+}
+
+// Use adds middlewares around the client for every following Send, and to
+// the handshakes of websockets and event streams. The first middleware
+// added is the outermost.
+func Use(middleware ...Middleware) {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	middlewares = append(middlewares, middleware...)
+}
+
+// UseCredentials adds middlewares that authenticate requests, such as
+// OAuth2Middleware or SigningMiddleware. They run inside the ones added with
+// Use, and redirects to another origin skip them.
+func UseCredentials(middleware ...Middleware) {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	credentials = append(credentials, middleware...)
+}
+
+// ClearMiddleware removes the middlewares added with Use and UseCredentials.
+func ClearMiddleware() {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	middlewares = nil
+	credentials = nil
+}
+
+// currentClient is the client wrapped in the middlewares, and in the
+// credential ones when withCredentials is set. direct reports that it is the
+// bare Client, which can stream request bodies.
+func currentClient(withCredentials bool) (doer Doer, direct bool) {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	_, direct = client.(Client)
+	chain := middlewares
+	if withCredentials {
+		chain = append(append([]Middleware{}, middlewares...), credentials...)
+	}
+	return Chain(client, chain...), direct && len(chain) == 0
+}
+
+// prepareHeaders passes a request the client does not send, such as a
+// websocket handshake, through the middlewares and returns the headers they
+// leave on it. Middlewares looking at the response see an empty one.
+func prepareHeaders(method string, inputUrl string, headers RequestHeader) (RequestHeader, error) {
+	clientMutex.Lock()
+	chain := append(append([]Middleware{}, middlewares...), credentials...)
+	clientMutex.Unlock()
+
+	prepared := copyHeaders(headers)
+	capture := DoerFunc(func(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+		prepared = headers
+		return BlankString, nil
+	})
+	if _, err := Chain(capture, chain...).Send(TransportTCP, method, inputUrl, prepared, nil); err != nil {
+		return nil, err
+	}
+	return prepared, nil
+}
@@ -0,0 +1,200 @@
+package libhttpc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	ExportGo   = "go"
+	ExportCurl = "curl"
+)
+
+// ExportRequest describes a request well enough to reproduce it. The body is
+// either Body or read from BodyFile, where "-" means stdin.
+type ExportRequest struct {
+	Transport string
+	Method    string
+	URL       string
+	Headers   RequestHeader
+	Body      []byte
+	BodyFile  string
+}
+
+// Export renders the request as a runnable snippet in the given format.
+func Export(format string, request ExportRequest) (string, error) {
+	switch format {
+	case ExportGo:
+		return ExportGoSnippet(request), nil
+	case ExportCurl:
+		return ExportCurlCommand(request), nil
+	}
+	return BlankString, fmt.Errorf("Unknown export format '%s', expected go or curl", format)
+}
+
+// ExportCurlCommand renders the request as a curl command line.
+func ExportCurlCommand(request ExportRequest) string {
+	parts := []string{"curl"}
+	method := strings.ToUpper(request.Method)
+	hasBody := len(request.Body) > 0 || request.BodyFile != BlankString
+	if method != "GET" && !(method == "POST" && hasBody) {
+		parts = append(parts, "-X", method)
+	}
+	for _, key := range exportedHeaderKeys(request.Headers) {
+		parts = append(parts, "-H", ShellQuote(key+": "+strings.TrimSpace(request.Headers[key])))
+	}
+	switch {
+	case request.BodyFile != BlankString:
+		parts = append(parts, "--data-binary", ShellQuote("@"+request.BodyFile))
+	case len(request.Body) > 0:
+		parts = append(parts, "--data-binary", ShellQuote(string(request.Body)))
+	}
+	parts = append(parts, ShellQuote(request.URL))
+	return strings.Join(parts, " ")
+}
+
+// ExportGoSnippet renders the request as a Go program sending it through
+// libhttpc.
+func ExportGoSnippet(request ExportRequest) string {
+	var snippet strings.Builder
+	imports := []string{`"fmt"`, `"httpc/pkg/libhttpc"`}
+	if request.BodyFile != BlankString {
+		imports = append(imports, `"io/ioutil"`)
+		if request.BodyFile == "-" {
+			imports = append(imports, `"os"`)
+		}
+	}
+	sort.Strings(imports)
+
+	snippet.WriteString("package main\n\nimport (\n")
+	for _, path := range imports {
+		fmt.Fprintf(&snippet, "\t%s\n", path)
+	}
+	snippet.WriteString(")\n\nfunc main() {\n")
+
+	keys := exportedHeaderKeys(request.Headers)
+	if len(keys) == 0 {
+		snippet.WriteString("\theaders := libhttpc.RequestHeader{}\n")
+	} else {
+		snippet.WriteString("\theaders := libhttpc.RequestHeader{\n")
+		for _, key := range keys {
+			fmt.Fprintf(&snippet, "\t\t%q: %q,\n", key, request.Headers[key])
+		}
+		snippet.WriteString("\t}\n")
+	}
+
+	switch {
+	case request.BodyFile == "-":
+		snippet.WriteString("\tbody, err := ioutil.ReadAll(os.Stdin)\n\tif err != nil {\n\t\tfmt.Println(err)\n\t\treturn\n\t}\n")
+	case request.BodyFile != BlankString:
+		fmt.Fprintf(&snippet, "\tbody, err := ioutil.ReadFile(%q)\n\tif err != nil {\n\t\tfmt.Println(err)\n\t\treturn\n\t}\n", request.BodyFile)
+	default:
+		fmt.Fprintf(&snippet, "\tbody := []byte(%q)\n", string(request.Body))
+	}
+
+	transport := "libhttpc.TransportUDP"
+	if request.Transport == TransportTCP {
+		transport = "libhttpc.TransportTCP"
+	}
+	fmt.Fprintf(&snippet, "\n\tresponse, err := libhttpc.Send(%s, %q, %q, headers, body)\n",
+		transport, strings.ToUpper(request.Method), request.URL)
+	snippet.WriteString("\tif err != nil {\n\t\tfmt.Println(err)\n\t\treturn\n\t}\n\tfmt.Print(response)\n}\n")
+	return snippet.String()
+}
+
+// exportedHeaderKeys sorts the headers, leaving out Content-Length which the
+// client computes itself.
+func exportedHeaderKeys(headers RequestHeader) []string {
+	keys := []string{}
+	for key := range headers {
+		if strings.EqualFold(key, "Content-Length") {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ShellQuote quotes a word for POSIX shells when it needs quoting.
+func ShellQuote(word string) string {
+	if word == BlankString {
+		return "''"
+	}
+	safe := true
+	for _, char := range word {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' ||
+			strings.ContainsRune("-_./:@%+=,", char)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// SplitCommandLine splits a shell command line into words, honouring single
+// and double quotes, backslash escapes and line continuations.
+func SplitCommandLine(line string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		switch {
+		case char == '\\':
+			if i+1 >= len(runes) {
+				return nil, errors.New("Unfinished escape at the end of the command")
+			}
+			i++
+			if runes[i] == '\n' {
+				continue
+			}
+			word.WriteRune(runes[i])
+			inWord = true
+		case char == '\'':
+			i++
+			for ; i < len(runes) && runes[i] != '\''; i++ {
+				word.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, errors.New("Unterminated single quote")
+			}
+			inWord = true
+		case char == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, errors.New("Unterminated double quote")
+			}
+			inWord = true
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(char)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,257 @@
+package libhttpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"strings"
+)
+
+const formatIndent = "  "
+
+// ANSI colours used for JSON values and markup tags.
+const (
+	colourReset   = "\033[0m"
+	colourKey     = "\033[34;1m"
+	colourString  = "\033[32m"
+	colourNumber  = "\033[36m"
+	colourLiteral = "\033[35m"
+	colourTag     = "\033[34m"
+)
+
+// FormatBody indents JSON, XML and HTML bodies according to their content
+// type and colours JSON and markup tags when colour is set. Invalid JSON is
+// returned unchanged.
+func FormatBody(contentType string, body string, colour bool) string {
+	switch bodyKind(contentType, body) {
+	case "json":
+		return FormatJSON(body, colour)
+	case "xml":
+		return FormatXML(body, colour)
+	case "html":
+		return FormatHTML(body, colour)
+	}
+	return body
+}
+
+// bodyKind picks the formatter from the media type, sniffing JSON only when
+// no type was sent.
+func bodyKind(contentType string, body string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return "xml"
+	case mediaType == "text/html":
+		return "html"
+	case mediaType == BlankString && json.Valid([]byte(body)):
+		return "json"
+	}
+	return BlankString
+}
+
+// FormatJSON indents a JSON document, keeping key order and number literals.
+func FormatJSON(body string, colour bool) string {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(strings.TrimSpace(body)), BlankString, formatIndent); err != nil {
+		return body
+	}
+	if !colour {
+		return indented.String()
+	}
+	return colourJSON(indented.String())
+}
+
+// colourJSON colours already valid, indented JSON. A string followed by ':'
+// is an object key.
+func colourJSON(text string) string {
+	var coloured strings.Builder
+	for i := 0; i < len(text); {
+		char := text[i]
+		switch {
+		case char == '"':
+			end := i + 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			colour := colourString
+			if strings.HasPrefix(strings.TrimLeft(text[end:], " "), ":") {
+				colour = colourKey
+			}
+			coloured.WriteString(colour + text[i:end] + colourReset)
+			i = end
+		case char == '-' || char >= '0' && char <= '9':
+			end := i
+			for end < len(text) && strings.IndexByte("-+.eE0123456789", text[end]) != -1 {
+				end++
+			}
+			coloured.WriteString(colourNumber + text[i:end] + colourReset)
+			i = end
+		case char >= 'a' && char <= 'z':
+			end := i
+			for end < len(text) && text[end] >= 'a' && text[end] <= 'z' {
+				end++
+			}
+			coloured.WriteString(colourLiteral + text[i:end] + colourReset)
+			i = end
+		default:
+			coloured.WriteByte(char)
+			i++
+		}
+	}
+	return coloured.String()
+}
+
+// FormatXML puts every element on its own line, indented by nesting depth.
+// Elements holding only text stay on one line.
+func FormatXML(body string, colour bool) string {
+	return indentMarkup(body, false, colour)
+}
+
+// htmlVoidElements never have a closing tag.
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// htmlRawElements keep their content exactly as sent.
+var htmlRawElements = map[string]bool{"script": true, "style": true, "pre": true, "textarea": true}
+
+// FormatHTML is FormatXML with HTML's void and raw text elements.
+func FormatHTML(body string, colour bool) string {
+	return indentMarkup(body, true, colour)
+}
+
+// indentMarkup is a tag scanner rather than a parser, so it copes with HTML
+// that is not well-formed and keeps the original text of every tag:
+// unmatched closing tags only reduce the depth.
+func indentMarkup(body string, html bool, colour bool) string {
+	var formatted strings.Builder
+	depth := 0
+	writeLine := func(text string) {
+		if colour {
+			text = colourTags(text)
+		}
+		formatted.WriteString(strings.Repeat(formatIndent, depth) + text + "\n")
+	}
+
+	rest := body
+	for rest != BlankString {
+		open := strings.IndexByte(rest, '<')
+		if open != 0 {
+			if open == -1 {
+				open = len(rest)
+			}
+			if text := strings.Join(strings.Fields(rest[:open]), " "); text != BlankString {
+				writeLine(text)
+			}
+			rest = rest[open:]
+			continue
+		}
+
+		end := htmlTagEnd(rest)
+		tag := rest[:end]
+		rest = rest[end:]
+		name := htmlTagName(tag)
+
+		switch {
+		case strings.HasPrefix(tag, "</"):
+			if depth > 0 {
+				depth--
+			}
+			writeLine(tag)
+		case strings.HasPrefix(tag, "<!") || strings.HasPrefix(tag, "<?") || strings.HasSuffix(tag, "/>"):
+			writeLine(tag)
+		case html && htmlVoidElements[name]:
+			writeLine(tag)
+		case html && htmlRawElements[name]:
+			closing := strings.Index(strings.ToLower(rest), "</"+name)
+			if closing == -1 {
+				closing = len(rest)
+			} else {
+				closing += htmlTagEnd(rest[closing:])
+			}
+			writeLine(tag + rest[:closing])
+			rest = rest[closing:]
+		default:
+			// keep '<name>text</name>' together
+			text := rest
+			if next := strings.IndexByte(rest, '<'); next != -1 {
+				text = rest[:next]
+			}
+			after := rest[len(text):]
+			if strings.HasPrefix(after, "</") && htmlTagName(after[:htmlTagEnd(after)]) == name {
+				closing := after[:htmlTagEnd(after)]
+				writeLine(tag + strings.TrimSpace(text) + closing)
+				rest = after[len(closing):]
+				continue
+			}
+			writeLine(tag)
+			depth++
+		}
+	}
+	return strings.TrimSuffix(formatted.String(), "\n")
+}
+
+// htmlTagEnd finds the '>' closing the tag at the start of text, skipping
+// quoted attribute values and whole comments.
+func htmlTagEnd(text string) int {
+	for _, delimiters := range [][2]string{{"<!--", "-->"}, {"<![CDATA[", "]]>"}} {
+		if strings.HasPrefix(text, delimiters[0]) {
+			if end := strings.Index(text, delimiters[1]); end != -1 {
+				return end + len(delimiters[1])
+			}
+			return len(text)
+		}
+	}
+	quote := byte(0)
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote != 0:
+			if text[i] == quote {
+				quote = 0
+			}
+		case text[i] == '"' || text[i] == '\'':
+			quote = text[i]
+		case text[i] == '>':
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+func htmlTagName(tag string) string {
+	name := strings.TrimLeft(tag, "</")
+	if end := strings.IndexAny(name, " \t\r\n/>"); end != -1 {
+		name = name[:end]
+	}
+	return strings.ToLower(name)
+}
+
+// colourTags colours every '<...>' in text.
+func colourTags(text string) string {
+	var coloured strings.Builder
+	for {
+		open := strings.IndexByte(text, '<')
+		if open == -1 {
+			coloured.WriteString(text)
+			return coloured.String()
+		}
+		end := strings.IndexByte(text[open:], '>')
+		if end == -1 {
+			coloured.WriteString(text)
+			return coloured.String()
+		}
+		end += open + 1
+		coloured.WriteString(text[:open] + colourTag + text[open:end] + colourReset)
+		text = text[end:]
+	}
+}
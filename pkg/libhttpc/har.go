@@ -0,0 +1,322 @@
+package libhttpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// exchange is a single request/response pair as seen by the transport. A
+// streamed body is not in body but captured while it is sent.
+type exchange struct {
+	started  time.Time
+	method   string
+	url      string
+	headers  RequestHeader
+	body     []byte
+	captured *bodyCapture
+	response string
+	serverIP string
+	connect  time.Duration
+	send     time.Duration
+	wait     time.Duration
+	receive  time.Duration
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARRecorder collects every exchange made while it is active.
+type HARRecorder struct {
+	mutex   sync.Mutex
+	entries []HAREntry
+}
+
+const harVersion = "1.2"
+
+const ClientVersion = "1.0"
+
+var activeRecorder *HARRecorder
+var recorderMutex sync.Mutex
+
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{}
+}
+
+// StartRecording makes every following exchange, redirect hops included, be
+// recorded into recorder.
+func StartRecording(recorder *HARRecorder) {
+	recorderMutex.Lock()
+	defer recorderMutex.Unlock()
+	activeRecorder = recorder
+}
+
+func StopRecording() {
+	StartRecording(nil)
+}
+
+func recording() bool {
+	recorderMutex.Lock()
+	defer recorderMutex.Unlock()
+	return activeRecorder != nil
+}
+
+// maxCapturedBody is how much of a streamed request body is kept for the
+// HAR file.
+const maxCapturedBody = 1024 * 1024
+
+// bodyCapture keeps the start of a streamed body and counts all of it.
+type bodyCapture struct {
+	data []byte
+	size int64
+}
+
+func (capture *bodyCapture) Write(data []byte) (int, error) {
+	capture.size += int64(len(data))
+	if room := maxCapturedBody - len(capture.data); room > 0 {
+		if room > len(data) {
+			room = len(data)
+		}
+		capture.data = append(capture.data, data[:room]...)
+	}
+	return len(data), nil
+}
+
+func recordExchange(record *exchange) {
+	recorderMutex.Lock()
+	recorder := activeRecorder
+	recorderMutex.Unlock()
+
+	if recorder != nil {
+		recorder.add(record)
+	}
+}
+
+func (recorder *HARRecorder) add(record *exchange) {
+	entry := HAREntry{
+		StartedDateTime: record.started.Format("2006-01-02T15:04:05.000Z07:00"),
+		Request:         harRequest(record),
+		Response:        harResponse(record.response),
+		ServerIPAddress: record.serverIP,
+		Timings: HARTimings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			Send:    milliseconds(record.send),
+			Wait:    milliseconds(record.wait),
+			Receive: milliseconds(record.receive),
+			SSL:     -1,
+		},
+	}
+	if record.connect > 0 {
+		entry.Timings.Connect = milliseconds(record.connect)
+	}
+	entry.Time = milliseconds(record.connect + record.send + record.wait + record.receive)
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.entries = append(recorder.entries, entry)
+}
+
+func (recorder *HARRecorder) Log() HARLog {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	entries := make([]HAREntry, len(recorder.entries))
+	copy(entries, recorder.entries)
+	return HARLog{
+		Version: harVersion,
+		Creator: HARCreator{Name: "httpc", Version: ClientVersion},
+		Entries: entries,
+	}
+}
+
+func (recorder *HARRecorder) WriteFile(path string) error {
+	encoded, err := json.MarshalIndent(map[string]HARLog{"log": recorder.Log()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, encoded, 0644)
+}
+
+func harRequest(record *exchange) HARRequest {
+	request := HARRequest{
+		Method:      record.method,
+		URL:         record.url,
+		HTTPVersion: ProtocolVersion,
+		Cookies:     []HARNameValue{},
+		Headers:     []HARNameValue{},
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(record.body),
+	}
+	body := record.body
+	if record.captured != nil {
+		body = record.captured.data
+		request.BodySize = int(record.captured.size)
+	}
+
+	keys := make([]string, 0, len(record.headers))
+	for key := range record.headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		request.Headers = append(request.Headers, HARNameValue{Name: key, Value: strings.TrimSpace(record.headers[key])})
+	}
+
+	if parsedURL, err := url.Parse(record.url); err == nil {
+		for key, values := range parsedURL.Query() {
+			for _, value := range values {
+				request.QueryString = append(request.QueryString, HARNameValue{Name: key, Value: value})
+			}
+		}
+	}
+
+	if len(body) > 0 {
+		text, encoding := harText(body)
+		mimeType := BlankString
+		for key, value := range record.headers {
+			if strings.EqualFold(key, "Content-Type") {
+				mimeType = strings.TrimSpace(value)
+			}
+		}
+		request.PostData = &HARPostData{MimeType: mimeType, Text: text, Encoding: encoding}
+		if request.BodySize > len(body) {
+			request.PostData.Comment = fmt.Sprintf("truncated to the first %d of %d bytes", len(body), request.BodySize)
+		}
+	}
+	return request
+}
+
+func harResponse(raw string) HARResponse {
+	response := HARResponse{
+		Cookies:     []HARNameValue{},
+		Headers:     []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+
+	parsed, err := FromString(raw)
+	if err != nil || parsed == nil {
+		return response
+	}
+
+	response.Status = parsed.StatusCode
+	response.HTTPVersion = parsed.Protocol
+	statusLine := strings.SplitN(strings.SplitN(raw, "\n", 2)[0], " ", 3)
+	if len(statusLine) == 3 {
+		response.StatusText = strings.TrimSpace(statusLine[2])
+	}
+
+	for _, header := range strings.Split(parsed.Headers, "\n") {
+		headerSet := strings.SplitN(header, ":", 2)
+		if len(headerSet) == 2 {
+			response.Headers = append(response.Headers, HARNameValue{
+				Name:  strings.TrimSpace(headerSet[0]),
+				Value: strings.TrimSpace(headerSet[1]),
+			})
+		}
+	}
+
+	text, encoding := harText([]byte(parsed.Body))
+	response.Content = HARContent{
+		Size:     len(parsed.Body),
+		MimeType: parsed.Header("Content-Type"),
+		Text:     text,
+		Encoding: encoding,
+	}
+	response.BodySize = len(parsed.Body)
+	response.RedirectURL = parsed.Header("Location")
+	return response
+}
+
+// harText returns the body as text, or base64 when it is not valid UTF-8.
+func harText(body []byte) (string, string) {
+	if utf8.Valid(body) && !strings.ContainsRune(string(body), 0) {
+		return string(body), BlankString
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -0,0 +1,51 @@
+package libhttpc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHARRecordsStreamedPostData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		received, _ := ioutil.ReadAll(request.Body)
+		fmt.Fprintf(writer, "%d", len(received))
+	}))
+	defer server.Close()
+
+	recorder := NewHARRecorder()
+	StartRecording(recorder)
+	defer StopRecording()
+
+	small := `{"name":"ann"}`
+	large := strings.Repeat("a", maxCapturedBody+10)
+	for _, body := range []string{small, large} {
+		headers := RequestHeader{"Content-Type": " application/json"}
+		if _, err := DoStream("POST", server.URL+"/upload", headers, strings.NewReader(body), int64(len(body))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := recorder.Log().Entries
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	first := entries[0].Request
+	if first.PostData == nil || first.PostData.Text != small || first.PostData.MimeType != "application/json" || first.BodySize != len(small) {
+		t.Fatalf("postData %+v, size %d, want the streamed body", first.PostData, first.BodySize)
+	}
+	if first.PostData.Comment != BlankString {
+		t.Fatalf("comment %q on a whole body", first.PostData.Comment)
+	}
+
+	second := entries[1].Request
+	if second.PostData == nil || len(second.PostData.Text) != maxCapturedBody || second.BodySize != len(large) {
+		t.Fatalf("postData of %d bytes, size %d, want the first %d of %d", len(second.PostData.Text), second.BodySize, maxCapturedBody, len(large))
+	}
+	if !strings.Contains(second.PostData.Comment, "truncated") {
+		t.Fatalf("comment %q, want a truncation marker", second.PostData.Comment)
+	}
+}
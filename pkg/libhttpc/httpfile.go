@@ -0,0 +1,255 @@
+package libhttpc
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HTTPFile is a parsed request collection in the VS Code REST Client /
+// JetBrains `.http` format.
+type HTTPFile struct {
+	Variables map[string]string
+	Requests  []HTTPFileRequest
+}
+
+type HTTPFileRequest struct {
+	Name    string
+	Method  string
+	URL     string
+	Headers []string
+	Body    string
+	Line    int
+}
+
+const requestSeparator = "###"
+
+func ParseHTTPFile(content string) (*HTTPFile, error) {
+	file := HTTPFile{Variables: map[string]string{}}
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(content, CRLF, "\n")))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var current *HTTPFileRequest
+	var bodyLines []string
+	inBody := false
+	pendingName := BlankString
+	lineNo := 0
+
+	flush := func() {
+		if current != nil {
+			current.Body = strings.TrimRight(strings.Join(bodyLines, "\n"), "\n")
+			file.Requests = append(file.Requests, *current)
+		}
+		current = nil
+		bodyLines = nil
+		inBody = false
+		pendingName = BlankString
+	}
+
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, requestSeparator) {
+			flush()
+			continue
+		}
+
+		if inBody {
+			bodyLines = append(bodyLines, line)
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+			comment := strings.TrimSpace(strings.TrimLeft(trimmed, "#/"))
+			if strings.HasPrefix(comment, "@name") {
+				name := strings.TrimSpace(strings.TrimPrefix(comment, "@name"))
+				name = strings.TrimSpace(strings.TrimPrefix(name, "="))
+				if current != nil {
+					current.Name = name
+				} else {
+					pendingName = name
+				}
+			}
+			continue
+		}
+
+		if current == nil {
+			if trimmed == BlankString {
+				continue
+			}
+			if strings.HasPrefix(trimmed, "@") {
+				separator := strings.Index(trimmed, "=")
+				if separator == -1 {
+					return nil, fmt.Errorf("line %d: variable definition is missing '='", lineNo)
+				}
+				key := strings.TrimSpace(trimmed[1:separator])
+				file.Variables[key] = strings.TrimSpace(trimmed[separator+1:])
+				continue
+			}
+			request, err := parseRequestLine(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err.Error())
+			}
+			request.Name = pendingName
+			request.Line = lineNo
+			current = request
+			continue
+		}
+
+		if trimmed == BlankString {
+			inBody = true
+			continue
+		}
+		if !strings.Contains(trimmed, ":") {
+			return nil, fmt.Errorf("line %d: malformed header '%s'", lineNo, trimmed)
+		}
+		current.Headers = append(current.Headers, trimmed)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	for i := range file.Requests {
+		if file.Requests[i].Name == BlankString {
+			file.Requests[i].Name = fmt.Sprintf("request%d", i+1)
+		}
+	}
+	return &file, nil
+}
+
+func ReadHTTPFile(path string) (*HTTPFile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseHTTPFile(string(content))
+}
+
+// String renders the file back into the .http format ParseHTTPFile reads.
+func (file *HTTPFile) String() string {
+	var content strings.Builder
+	keys := make([]string, 0, len(file.Variables))
+	for key := range file.Variables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&content, "@%s = %s\n", key, file.Variables[key])
+	}
+	if len(keys) > 0 {
+		content.WriteString("\n")
+	}
+
+	for i, request := range file.Requests {
+		if i > 0 {
+			content.WriteString("\n")
+		}
+		content.WriteString(requestSeparator + "\n")
+		if request.Name != BlankString {
+			fmt.Fprintf(&content, "# @name %s\n", request.Name)
+		}
+		fmt.Fprintf(&content, "%s %s\n", request.Method, request.URL)
+		for _, header := range request.Headers {
+			content.WriteString(header + "\n")
+		}
+		if request.Body != BlankString {
+			content.WriteString("\n" + request.Body + "\n")
+		}
+	}
+	return content.String()
+}
+
+func WriteHTTPFile(path string, file *HTTPFile) error {
+	return ioutil.WriteFile(path, []byte(file.String()), 0644)
+}
+
+func parseRequestLine(line string) (*HTTPFileRequest, error) {
+	fields := strings.Fields(line)
+	request := HTTPFileRequest{Method: "GET"}
+
+	switch {
+	case len(fields) == 1:
+		request.URL = fields[0]
+	case len(fields) >= 2 && isHTTPMethod(fields[0]):
+		request.Method = strings.ToUpper(fields[0])
+		request.URL = fields[1]
+	case len(fields) == 2 && strings.HasPrefix(fields[1], "HTTP/"):
+		request.URL = fields[0]
+	default:
+		return nil, fmt.Errorf("malformed request line '%s'", line)
+	}
+	return &request, nil
+}
+
+func isHTTPMethod(token string) bool {
+	switch strings.ToUpper(token) {
+	case "GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS", "TRACE", "CONNECT":
+		return true
+	}
+	return false
+}
+
+// SubstituteVariables replaces every `{{expression}}` in text with the value
+// returned by lookup. Substituted values are not scanned again.
+func SubstituteVariables(text string, lookup func(expression string) (string, error)) (string, error) {
+	var result strings.Builder
+	for {
+		start := strings.Index(text, "{{")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(text[start:], "}}")
+		if end == -1 {
+			return BlankString, fmt.Errorf("unterminated '{{' in '%s'", text)
+		}
+		value, err := lookup(strings.TrimSpace(text[start+2 : start+end]))
+		if err != nil {
+			return BlankString, err
+		}
+		result.WriteString(text[:start])
+		result.WriteString(value)
+		text = text[start+end+2:]
+	}
+	result.WriteString(text)
+	return result.String(), nil
+}
+
+// ResolveResponseReference resolves the part of a named request reference
+// after the request name, e.g. `response.body.$.token`,
+// `response.headers.Location` or `response.status`.
+func ResolveResponseReference(response *Response, reference string) (string, error) {
+	if response == nil {
+		return BlankString, fmt.Errorf("no response available for '%s'", reference)
+	}
+	parts := strings.SplitN(reference, ".", 3)
+	if len(parts) < 2 || parts[0] != "response" {
+		return BlankString, fmt.Errorf("unsupported reference '%s'", reference)
+	}
+
+	switch parts[1] {
+	case "status":
+		return strconv.Itoa(response.StatusCode), nil
+	case "headers":
+		if len(parts) < 3 {
+			return response.Headers, nil
+		}
+		return response.Header(parts[2]), nil
+	case "body":
+		if len(parts) < 3 || parts[2] == "*" {
+			return response.Body, nil
+		}
+		value, err := EvaluateJSONPath(response.Body, parts[2])
+		if err != nil {
+			return BlankString, err
+		}
+		return FormatJSONValue(value), nil
+	}
+	return BlankString, fmt.Errorf("unsupported reference '%s'", reference)
+}
@@ -0,0 +1,121 @@
+package libhttpc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseHTTPFile(t *testing.T) {
+	file, err := ParseHTTPFile("@host = http://localhost:8080\r\n" +
+		"@token = {{$processEnv TOKEN}}\n" +
+		"\n" +
+		"# @name login\n" +
+		"POST {{host}}/login HTTP/1.1\n" +
+		"Content-Type: application/json\n" +
+		"\n" +
+		"{\"user\": \"ann\"}\n" +
+		"\n" +
+		"###\n" +
+		"// @name = profile\n" +
+		"{{host}}/me\n" +
+		"Authorization: Bearer {{login.response.body.$.token}}\n" +
+		"### third\n" +
+		"delete {{host}}/me\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(file.Variables, map[string]string{"host": "http://localhost:8080", "token": "{{$processEnv TOKEN}}"}) {
+		t.Errorf("variables %v", file.Variables)
+	}
+	want := []HTTPFileRequest{
+		{Name: "login", Method: "POST", URL: "{{host}}/login", Headers: []string{"Content-Type: application/json"}, Body: `{"user": "ann"}`, Line: 5},
+		{Name: "profile", Method: "GET", URL: "{{host}}/me", Headers: []string{"Authorization: Bearer {{login.response.body.$.token}}"}, Line: 12},
+		{Name: "request3", Method: "DELETE", URL: "{{host}}/me", Line: 15},
+	}
+	if !reflect.DeepEqual(file.Requests, want) {
+		t.Fatalf("requests:\n got %+v\nwant %+v", file.Requests, want)
+	}
+
+	// String writes what ParseHTTPFile reads back
+	again, err := ParseHTTPFile(file.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range again.Requests {
+		again.Requests[i].Line = want[i].Line
+	}
+	if !reflect.DeepEqual(again.Requests, want) || !reflect.DeepEqual(again.Variables, file.Variables) {
+		t.Fatalf("round trip:\n%s", file.String())
+	}
+}
+
+func TestParseHTTPFileErrors(t *testing.T) {
+	cases := map[string]string{
+		"variable without =": "@host http://localhost\n",
+		"request line":       "FETCH http://a b c\n",
+		"header":             "GET http://localhost\nnot a header\n",
+	}
+	for name, content := range cases {
+		if _, err := ParseHTTPFile(content); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func TestSubstituteVariables(t *testing.T) {
+	values := map[string]string{"host": "example.com", "id": "{{host}}"}
+	lookup := func(expression string) (string, error) {
+		if value, ok := values[expression]; ok {
+			return value, nil
+		}
+		return BlankString, errors.New("undefined " + expression)
+	}
+	cases := map[string]string{
+		"http://{{host}}/users/{{ id }}": "http://example.com/users/{{host}}",
+		"no variables":                   "no variables",
+		"{{host}}{{host}}":               "example.comexample.com",
+		"single { braces }":              "single { braces }",
+	}
+	for text, want := range cases {
+		if got, err := SubstituteVariables(text, lookup); err != nil || got != want {
+			t.Errorf("SubstituteVariables(%q) = %q, %v, want %q", text, got, err, want)
+		}
+	}
+	for _, text := range []string{"{{host", "{{missing}}"} {
+		if got, err := SubstituteVariables(text, lookup); err == nil {
+			t.Errorf("SubstituteVariables(%q) = %q, want an error", text, got)
+		}
+	}
+}
+
+func TestResolveResponseReference(t *testing.T) {
+	response, err := FromString("HTTP/1.1 201 Created\r\nLocation: /users/7\r\nContent-Type: application/json\r\n\r\n" +
+		`{"token":"abc","user":{"id":7,"roles":["admin"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"response.status":                 "201",
+		"response.headers.Location":       "/users/7",
+		"response.body.$.token":           "abc",
+		"response.body.$.user.id":         "7",
+		"response.body.$.user.roles":      `["admin"]`,
+		"response.body.*":                 response.Body,
+		"response.body":                   response.Body,
+		"response.headers.Missing-Header": "",
+	}
+	for reference, want := range cases {
+		if got, err := ResolveResponseReference(response, reference); err != nil || got != want {
+			t.Errorf("%s = %q, %v, want %q", reference, got, err, want)
+		}
+	}
+	for _, reference := range []string{"request.body", "response.cookies", "response", "response.body.$.missing"} {
+		if got, err := ResolveResponseReference(response, reference); err == nil {
+			t.Errorf("%s = %q, want an error", reference, got)
+		}
+	}
+	if _, err := ResolveResponseReference(nil, "response.status"); err == nil {
+		t.Error("want an error without a response")
+	}
+}
@@ -0,0 +1,103 @@
+package libhttpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EvaluateJSONPath resolves a simple path such as `$.items[0].name` or
+// `.items[0].name` against a JSON document.
+func EvaluateJSONPath(document string, path string) (interface{}, error) {
+	var parsed interface{}
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return LookupJSONPath(parsed, path)
+}
+
+// LookupJSONPath walks an already decoded JSON value.
+func LookupJSONPath(value interface{}, path string) (interface{}, error) {
+	tokens, err := splitJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := value
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("Key '%s' not found in path '%s'", token, path)
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil {
+				return nil, fmt.Errorf("Expected an array index in path '%s', got '%s'", path, token)
+			}
+			if index < 0 {
+				index += len(node)
+			}
+			if index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("Index %s out of range in path '%s'", token, path)
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("Cannot descend into '%s' in path '%s'", token, path)
+		}
+	}
+	return current, nil
+}
+
+// FormatJSONValue renders strings verbatim and everything else as compact JSON.
+func FormatJSONValue(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
+
+func splitJSONPath(path string) ([]string, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	tokens := []string{}
+
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			end := i + 1
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			if end > i+1 {
+				tokens = append(tokens, path[i+1:end])
+			}
+			i = end
+		case '[':
+			end := strings.Index(path[i:], "]")
+			if end == -1 {
+				return nil, fmt.Errorf("Unterminated '[' in path '%s'", path)
+			}
+			token := strings.Trim(path[i+1:i+end], `"'`)
+			tokens = append(tokens, token)
+			i += end + 1
+		default:
+			end := i
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			tokens = append(tokens, path[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
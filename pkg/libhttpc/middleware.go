@@ -0,0 +1,86 @@
+package libhttpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a Doer to act on every request and response passing
+// through it, eg. to add headers, sign requests or collect metrics.
+type Middleware func(next Doer) Doer
+
+// DefaultRequestIDHeader is the header RequestIDMiddleware sets by default.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// Chain wraps doer in middlewares, the first one being the outermost.
+func Chain(doer Doer, middlewares ...Middleware) Doer {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		doer = middlewares[i](doer)
+	}
+	return doer
+}
+
+// HeaderMiddleware adds the headers a request does not already have.
+func HeaderMiddleware(headers RequestHeader) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(transport string, method string, inputUrl string, requestHeaders RequestHeader, body []byte) (string, error) {
+			for key, value := range headers {
+				if !hasHeader(requestHeaders, key) {
+					requestHeaders[key] = value
+				}
+			}
+			return next.Send(transport, method, inputUrl, requestHeaders, body)
+		})
+	}
+}
+
+// UserAgentMiddleware sets the User-Agent header unless the request has one.
+func UserAgentMiddleware(agent string) Middleware {
+	return HeaderMiddleware(RequestHeader{"User-Agent": " " + agent})
+}
+
+// RequestIDMiddleware gives every request without the header a random
+// 128-bit hex id, DefaultRequestIDHeader when header is empty.
+func RequestIDMiddleware(header string) Middleware {
+	if header == BlankString {
+		header = DefaultRequestIDHeader
+	}
+	return func(next Doer) Doer {
+		return DoerFunc(func(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+			if !hasHeader(headers, header) {
+				id := make([]byte, 16)
+				if _, err := rand.Read(id); err != nil {
+					return BlankString, err
+				}
+				headers[header] = " " + hex.EncodeToString(id)
+			}
+			return next.Send(transport, method, inputUrl, headers, body)
+		})
+	}
+}
+
+// LoggingMiddleware logs every request with its status or error and
+// duration, as 'GET http://host/path -> 200 (12ms)'.
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+			started := time.Now()
+			raw, err := next.Send(transport, method, inputUrl, headers, body)
+			elapsed := time.Since(started).Round(time.Millisecond)
+
+			outcome := "error: " + fmt.Sprint(err)
+			if err == nil {
+				outcome = "malformed response"
+				if response, _ := FromString(raw); response != nil {
+					outcome = fmt.Sprint(response.StatusCode)
+				}
+			}
+			logger.Printf("%s %s -> %s (%s)", strings.ToUpper(method), inputUrl, outcome, elapsed)
+			return raw, err
+		})
+	}
+}
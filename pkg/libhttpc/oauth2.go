@@ -0,0 +1,181 @@
+package libhttpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth2Config describes a token endpoint. With a RefreshToken the
+// refresh_token grant is used first, otherwise client_credentials.
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RefreshToken string
+	// Transport the token request goes over, TransportTCP when empty.
+	Transport string
+}
+
+type OAuth2Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    int       `json:"expires_in"`
+	Expiry       time.Time `json:"-"`
+}
+
+// oauth2ExpiryMargin renews a token that much before it expires, so it does
+// not run out while a request is in flight.
+const oauth2ExpiryMargin = 10 * time.Second
+
+// Valid reports whether the token has not expired; a token without
+// expires_in never does.
+func (token *OAuth2Token) Valid() bool {
+	return token != nil && token.AccessToken != BlankString &&
+		(token.Expiry.IsZero() || time.Now().Add(oauth2ExpiryMargin).Before(token.Expiry))
+}
+
+// OAuth2Source fetches tokens and caches them until they expire.
+type OAuth2Source struct {
+	// Doer sends the token requests, the default Client when nil. They do
+	// not go through the package middlewares.
+	Doer Doer
+
+	config       OAuth2Config
+	mutex        sync.Mutex
+	token        *OAuth2Token
+	refreshToken string
+}
+
+func NewOAuth2Source(config OAuth2Config) *OAuth2Source {
+	if config.Transport == BlankString {
+		config.Transport = TransportTCP
+	}
+	return &OAuth2Source{config: config, refreshToken: config.RefreshToken}
+}
+
+// Token returns the cached token or fetches a new one.
+func (source *OAuth2Source) Token() (*OAuth2Token, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if source.token.Valid() {
+		return source.token, nil
+	}
+
+	var token *OAuth2Token
+	var err error
+	if source.refreshToken != BlankString {
+		token, err = source.fetch(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {source.refreshToken}})
+		if err != nil && source.config.ClientSecret == BlankString {
+			return nil, err
+		}
+	}
+	if token == nil {
+		token, err = source.fetch(url.Values{"grant_type": {"client_credentials"}})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if token.RefreshToken != BlankString {
+		source.refreshToken = token.RefreshToken
+	}
+	source.token = token
+	return token, nil
+}
+
+// Invalidate drops the cached token, eg. after the server rejected it.
+func (source *OAuth2Source) Invalidate(token *OAuth2Token) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if source.token == token {
+		source.token = nil
+	}
+}
+
+// fetch posts a grant to the token endpoint. The client authenticates with
+// HTTP Basic as RFC 6749 recommends.
+func (source *OAuth2Source) fetch(form url.Values) (*OAuth2Token, error) {
+	if len(source.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(source.config.Scopes, " "))
+	}
+	headers := RequestHeader{
+		"Content-Type": " application/x-www-form-urlencoded",
+		"Accept":       " application/json",
+	}
+	if source.config.ClientSecret != BlankString {
+		credentials := url.QueryEscape(source.config.ClientID) + ":" + url.QueryEscape(source.config.ClientSecret)
+		headers["Authorization"] = " Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	} else {
+		form.Set("client_id", source.config.ClientID)
+	}
+
+	doer := source.Doer
+	if doer == nil {
+		doer = Client{}
+	}
+	raw, err := doer.Send(source.config.Transport, "POST", source.config.TokenURL, headers, []byte(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	response, err := FromString(raw)
+	if err == nil && response == nil {
+		err = fmt.Errorf("Malformed response")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Token request failed: %s", err.Error())
+	}
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("Token endpoint returned %d: %s", response.StatusCode, strings.TrimSpace(response.Body))
+	}
+
+	token := &OAuth2Token{}
+	if err := json.Unmarshal([]byte(response.Body), token); err != nil {
+		return nil, fmt.Errorf("Invalid token response: %s", err.Error())
+	}
+	if token.AccessToken == BlankString {
+		return nil, fmt.Errorf("Token response has no access_token")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// OAuth2Middleware sends 'Authorization: Bearer' with every request that has
+// no Authorization header. A 401 drops the token and the request is sent
+// once more with a fresh one.
+func OAuth2Middleware(source *OAuth2Source) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+			if hasHeader(headers, "Authorization") {
+				return next.Send(transport, method, inputUrl, headers, body)
+			}
+			token, err := source.Token()
+			if err != nil {
+				return BlankString, err
+			}
+			headers["Authorization"] = " Bearer " + token.AccessToken
+			raw, err := next.Send(transport, method, inputUrl, headers, body)
+			if err != nil {
+				return raw, err
+			}
+			if response, _ := FromString(raw); response == nil || response.StatusCode != 401 {
+				return raw, nil
+			}
+
+			source.Invalidate(token)
+			token, err = source.Token()
+			if err != nil {
+				return BlankString, err
+			}
+			headers["Authorization"] = " Bearer " + token.AccessToken
+			return next.Send(transport, method, inputUrl, headers, body)
+		})
+	}
+}
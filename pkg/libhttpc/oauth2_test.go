@@ -0,0 +1,142 @@
+package libhttpc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// tokenEndpoint hands out access tokens t1, t2... with the lifetime set,
+// and records the grant of every request.
+type tokenEndpoint struct {
+	mutex     sync.Mutex
+	grants    []string
+	expiresIn int
+}
+
+func (endpoint *tokenEndpoint) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if user, password, ok := request.BasicAuth(); !ok || user != "client" || password != "secret" {
+		http.Error(writer, "bad client", http.StatusUnauthorized)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	endpoint.mutex.Lock()
+	endpoint.grants = append(endpoint.grants, request.PostForm.Get("grant_type"))
+	issued := len(endpoint.grants)
+	endpoint.mutex.Unlock()
+
+	writer.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(writer, `{"access_token":"t%d","token_type":"Bearer","refresh_token":"r%d","expires_in":%d}`,
+		issued, issued, endpoint.expiresIn)
+}
+
+func (endpoint *tokenEndpoint) requests() []string {
+	endpoint.mutex.Lock()
+	defer endpoint.mutex.Unlock()
+	return append([]string{}, endpoint.grants...)
+}
+
+func newTokenSource(t *testing.T, expiresIn int) (*OAuth2Source, *tokenEndpoint) {
+	endpoint := &tokenEndpoint{expiresIn: expiresIn}
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+	return NewOAuth2Source(OAuth2Config{TokenURL: server.URL + "/token", ClientID: "client", ClientSecret: "secret"}), endpoint
+}
+
+func TestOAuth2SourceCachesToken(t *testing.T) {
+	source, endpoint := newTokenSource(t, 3600)
+	for i := 0; i < 3; i++ {
+		token, err := source.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "t1" {
+			t.Fatalf("token %q, want the cached t1", token.AccessToken)
+		}
+	}
+	if grants := endpoint.requests(); len(grants) != 1 || grants[0] != "client_credentials" {
+		t.Fatalf("grants %v, want a single client_credentials", grants)
+	}
+}
+
+func TestOAuth2SourceRenewsExpiredToken(t *testing.T) {
+	// a token expiring within oauth2ExpiryMargin is renewed right away
+	source, endpoint := newTokenSource(t, 1)
+	first, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.AccessToken != "t1" || second.AccessToken != "t2" {
+		t.Fatalf("tokens %q and %q, want t1 then t2", first.AccessToken, second.AccessToken)
+	}
+	// the refresh token of the first response is used for the second
+	if grants := endpoint.requests(); len(grants) != 2 || grants[1] != "refresh_token" {
+		t.Fatalf("grants %v, want client_credentials then refresh_token", grants)
+	}
+}
+
+func TestOAuth2MiddlewareRefreshesOn401(t *testing.T) {
+	source, endpoint := newTokenSource(t, 3600)
+	var authorizations []string
+	resource := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		authorizations = append(authorizations, request.Header.Get("Authorization"))
+		if request.Header.Get("Authorization") != "Bearer t2" {
+			http.Error(writer, "expired", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(writer, "ok")
+	}))
+	defer resource.Close()
+
+	doer := Chain(Client{}, OAuth2Middleware(source))
+	raw, err := doer.Send(TransportTCP, "GET", resource.URL+"/data", RequestHeader{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, _ := FromString(raw)
+	if response == nil || response.StatusCode != 200 || response.Body != "ok" {
+		t.Fatalf("got %q, want 200 ok after a refresh", raw)
+	}
+	if len(authorizations) != 2 || authorizations[0] != "Bearer t1" || authorizations[1] != "Bearer t2" {
+		t.Fatalf("Authorization %v, want t1 then t2", authorizations)
+	}
+	if grants := endpoint.requests(); len(grants) != 2 {
+		t.Fatalf("grants %v, want one more after the 401", grants)
+	}
+
+	// the fresh token is cached for the next request
+	if _, err := doer.Send(TransportTCP, "GET", resource.URL+"/data", RequestHeader{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if grants := endpoint.requests(); len(grants) != 2 {
+		t.Fatalf("grants %v, want the token reused", grants)
+	}
+}
+
+func TestPrepareHeadersRunsMiddlewares(t *testing.T) {
+	source, _ := newTokenSource(t, 3600)
+	Use(UserAgentMiddleware("httpc-test"))
+	UseCredentials(OAuth2Middleware(source))
+	defer ClearMiddleware()
+
+	headers := RequestHeader{"Accept": " text/event-stream"}
+	prepared, err := prepareHeaders("GET", "ws://example.com/socket", headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prepared["User-Agent"] != " httpc-test" || prepared["Authorization"] != " Bearer t1" || prepared["Accept"] != " text/event-stream" {
+		t.Fatalf("prepared headers %v", prepared)
+	}
+	if len(headers) != 1 {
+		t.Fatalf("caller's headers changed: %v", headers)
+	}
+}
@@ -0,0 +1,159 @@
+package libhttpc
+
+import (
+	"fmt"
+	"httpc/pkg/rudp"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by every connection of the client.
+// Callers reserve the bytes they are about to move and sleep off any debt, so
+// concurrent requests split the rate between them.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var rateLimiter *RateLimiter
+
+// NewRateLimiter allows bytesPerSecond on average with bursts of a tenth of a
+// second.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	burst := float64(bytesPerSecond) / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// SetRateLimit throttles request bodies, response reads and the packets of
+// UDP connections, retransmissions included, to bytesPerSecond. 0 removes the
+// limit.
+func SetRateLimit(bytesPerSecond int64) {
+	if bytesPerSecond <= 0 {
+		rateLimiter = nil
+		return
+	}
+	rateLimiter = NewRateLimiter(bytesPerSecond)
+}
+
+// Wait blocks until n bytes may be transferred.
+func (limiter *RateLimiter) Wait(n int) {
+	limiter.mutex.Lock()
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.burst {
+		limiter.tokens = limiter.burst
+	}
+	limiter.last = now
+	limiter.tokens -= float64(n)
+	debt := limiter.tokens
+	limiter.mutex.Unlock()
+
+	if debt < 0 {
+		time.Sleep(time.Duration(-debt / limiter.rate * float64(time.Second)))
+	}
+}
+
+// chunk is the largest transfer that is worth reserving at once.
+func (limiter *RateLimiter) chunk() int {
+	return int(limiter.burst)
+}
+
+// ParseRate parses a rate in bytes per second as curl does: a number with an
+// optional K, M or G suffix in powers of 1024.
+func ParseRate(spec string) (int64, error) {
+	rate := strings.TrimSpace(spec)
+	multiplier := int64(1)
+	if rate != BlankString {
+		switch strings.ToUpper(rate[len(rate)-1:]) {
+		case "K":
+			multiplier = 1024
+		case "M":
+			multiplier = 1024 * 1024
+		case "G":
+			multiplier = 1024 * 1024 * 1024
+		}
+		if multiplier > 1 {
+			rate = rate[:len(rate)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(rate, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("Invalid rate '%s', expected a number of bytes with an optional K, M or G suffix", spec)
+	}
+	// a rate that rounds to 0 would turn the limit off instead
+	bytesPerSecond := int64(value * float64(multiplier))
+	if bytesPerSecond < 1 {
+		return 0, fmt.Errorf("Invalid rate '%s', expected at least 1 byte per second", spec)
+	}
+	return bytesPerSecond, nil
+}
+
+// limitedConn throttles a stream connection through the client's limiter.
+// The packets of a UDP connection are paced by rudp itself, so paced writes
+// only go out in whole packets.
+type limitedConn struct {
+	net.Conn
+	limiter *RateLimiter
+	paced   bool
+}
+
+func throttle(conn net.Conn) net.Conn {
+	if rateLimiter == nil {
+		return conn
+	}
+	inner := conn
+	if stats, ok := conn.(*statsConn); ok {
+		inner = stats.Conn
+	}
+	_, paced := inner.(*rudp.Conn)
+	return &limitedConn{Conn: conn, limiter: rateLimiter, paced: paced}
+}
+
+func (conn *limitedConn) Read(buffer []byte) (int, error) {
+	if len(buffer) > conn.limiter.chunk() {
+		buffer = buffer[:conn.limiter.chunk()]
+	}
+	n, err := conn.Conn.Read(buffer)
+	conn.limiter.Wait(n)
+	return n, err
+}
+
+func (conn *limitedConn) Write(data []byte) (int, error) {
+	if conn.paced {
+		return conn.Conn.Write(data)
+	}
+	// writes are at least a packet so a low rate does not split them small
+	chunk := conn.limiter.chunk()
+	if chunk < rudp.MaxPayloadSize {
+		chunk = rudp.MaxPayloadSize
+	}
+	written := 0
+	for written < len(data) {
+		end := written + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		conn.limiter.Wait(end - written)
+		n, err := conn.Conn.Write(data[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
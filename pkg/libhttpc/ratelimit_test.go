@@ -0,0 +1,25 @@
+package libhttpc
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	valid := map[string]int64{
+		"1":     1,
+		"100":   100,
+		"2K":    2048,
+		"1.5k":  1536,
+		"1M":    1024 * 1024,
+		" 1G ":  1024 * 1024 * 1024,
+		"0.01K": 10,
+	}
+	for spec, want := range valid {
+		if got, err := ParseRate(spec); err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", spec, got, err, want)
+		}
+	}
+	for _, spec := range []string{"", "K", "fast", "-1", "0", "0.5", "0.0001K"} {
+		if got, err := ParseRate(spec); err == nil {
+			t.Errorf("ParseRate(%q) = %d, want an error", spec, got)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package libhttpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signer adds the headers authenticating a request. now is the signing time.
+type Signer interface {
+	Sign(method string, inputUrl string, headers RequestHeader, body []byte, now time.Time) error
+}
+
+// SigningMiddleware signs every request with signer. It has to come after
+// the middlewares that add headers, or their headers are not signed.
+func SigningMiddleware(signer Signer) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(transport string, method string, inputUrl string, headers RequestHeader, body []byte) (string, error) {
+			if err := signer.Sign(strings.ToUpper(method), inputUrl, headers, body, time.Now()); err != nil {
+				return BlankString, err
+			}
+			return next.Send(transport, method, inputUrl, headers, body)
+		})
+	}
+}
+
+// HMACSigner signs the method, path, sorted query, Headers and the SHA-256
+// of the body with HMAC-SHA256. It sets Date and X-Content-SHA256 when they
+// are missing and adds
+//
+//	Authorization: HMAC-SHA256 keyId="id",headers="host date content-type x-content-sha256",signature="base64"
+//
+// The string signed is the method, path, query, one 'name:value' line per
+// signed header and the body hash, joined by newlines.
+type HMACSigner struct {
+	KeyID   string
+	Secret  string
+	Headers []string
+}
+
+// DefaultHMACHeaders are signed when an HMACSigner lists no Headers. Headers
+// missing from a request are signed as empty.
+var DefaultHMACHeaders = []string{"host", "date", "content-type", "x-content-sha256"}
+
+// ParseHMACSigner reads 'hmac:keyid:secret'. The secret may contain ':'.
+func ParseHMACSigner(spec string) (*HMACSigner, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || !strings.EqualFold(parts[0], "hmac") || parts[1] == BlankString || parts[2] == BlankString {
+		return nil, fmt.Errorf("Invalid signing spec '%s', expected hmac:keyid:secret", spec)
+	}
+	return &HMACSigner{KeyID: parts[1], Secret: parts[2]}, nil
+}
+
+func (signer *HMACSigner) Sign(method string, inputUrl string, headers RequestHeader, body []byte, now time.Time) error {
+	parsedURL, err := url.Parse(inputUrl)
+	if err != nil {
+		return err
+	}
+	setSignedHeader(headers, "Host", parsedURL.Host)
+	setSignedHeader(headers, "Date", now.UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT"))
+	setSignedHeader(headers, "X-Content-SHA256", sha256Hex(body))
+
+	names := signer.Headers
+	if len(names) == 0 {
+		names = DefaultHMACHeaders
+	}
+	lines := []string{method, canonicalPath(parsedURL, false), canonicalQuery(parsedURL)}
+	lowered := make([]string, len(names))
+	for i, name := range names {
+		lowered[i] = strings.ToLower(name)
+		lines = append(lines, lowered[i]+":"+canonicalHeaderValue(headerValue(headers, name)))
+	}
+	lines = append(lines, sha256Hex(body))
+
+	mac := hmac.New(sha256.New, []byte(signer.Secret))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	headers["Authorization"] = fmt.Sprintf(` HMAC-SHA256 keyId="%s",headers="%s",signature="%s"`,
+		signer.KeyID, strings.Join(lowered, " "), signature)
+	return nil
+}
+
+// SigV4Signer implements AWS Signature Version 4. Provider names the
+// algorithm and headers as curl does: 'aws' signs with AWS4-HMAC-SHA256 and
+// X-Amz-Date, 'osc' with OSC4-HMAC-SHA256 and X-Osc-Date.
+type SigV4Signer struct {
+	Provider     string
+	Region       string
+	Service      string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// ParseSigV4Signer reads 'provider:region:service' and takes the credentials
+// from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func ParseSigV4Signer(spec string) (*SigV4Signer, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 || parts[0] == BlankString || parts[1] == BlankString || parts[2] == BlankString {
+		return nil, fmt.Errorf("Invalid SigV4 spec '%s', expected provider:region:service", spec)
+	}
+	signer := &SigV4Signer{
+		Provider:     strings.ToLower(parts[0]),
+		Region:       parts[1],
+		Service:      parts[2],
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if signer.AccessKey == BlankString || signer.SecretKey == BlankString {
+		return nil, fmt.Errorf("SigV4 needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return signer, nil
+}
+
+// Sign signs host, content-type and every x-<provider>- header. S3 gets the
+// payload hash header it requires and its paths are not encoded twice.
+func (signer *SigV4Signer) Sign(method string, inputUrl string, headers RequestHeader, body []byte, now time.Time) error {
+	parsedURL, err := url.Parse(inputUrl)
+	if err != nil {
+		return err
+	}
+	provider := strings.ToLower(signer.Provider)
+	if provider == BlankString {
+		provider = "aws"
+	}
+	headerProvider := provider
+	if provider == "aws" {
+		headerProvider = "amz"
+	}
+	headerPrefix := "x-" + headerProvider + "-"
+	algorithm := strings.ToUpper(provider) + "4-HMAC-SHA256"
+	timestamp := now.UTC().Format("20060102T150405Z")
+	date := timestamp[:8]
+	payloadHash := sha256Hex(body)
+
+	setSignedHeader(headers, "Host", parsedURL.Host)
+	headers[canonicalProviderHeader(headerProvider, "Date")] = " " + timestamp
+	if signer.Service == "s3" {
+		headers[canonicalProviderHeader(headerProvider, "Content-Sha256")] = " " + payloadHash
+	}
+	if signer.SessionToken != BlankString {
+		headers[canonicalProviderHeader(headerProvider, "Security-Token")] = " " + signer.SessionToken
+	}
+
+	signed := map[string]string{}
+	for key, value := range headers {
+		name := strings.ToLower(strings.TrimSpace(key))
+		if name == "host" || name == "content-type" || strings.HasPrefix(name, headerPrefix) {
+			signed[name] = canonicalHeaderValue(value)
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalPath(parsedURL, signer.Service != "s3"),
+		canonicalQuery(parsedURL),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	terminator := provider + "4_request"
+	scope := strings.Join([]string{date, signer.Region, signer.Service, terminator}, "/")
+	stringToSign := strings.Join([]string{algorithm, timestamp, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte(strings.ToUpper(provider) + "4" + signer.SecretKey)
+	for _, part := range []string{date, signer.Region, signer.Service, terminator} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	headers["Authorization"] = fmt.Sprintf(" %s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, signer.AccessKey, scope, signedHeaders, signature)
+	return nil
+}
+
+// canonicalProviderHeader builds eg. X-Amz-Date from the provider and name.
+func canonicalProviderHeader(provider string, name string) string {
+	return "X-" + strings.ToUpper(provider[:1]) + provider[1:] + "-" + name
+}
+
+// setSignedHeader sets a header the signature covers unless the request
+// already has it, so the value signed is the value sent.
+func setSignedHeader(headers RequestHeader, key string, value string) {
+	if !hasHeader(headers, key) {
+		headers[key] = " " + value
+	}
+}
+
+// canonicalPath URI-encodes every path segment, twice when double is set as
+// SigV4 requires for services other than S3.
+func canonicalPath(parsedURL *url.URL, double bool) string {
+	path := parsedURL.Path
+	if path == BlankString {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+		if double {
+			segments[i] = uriEncode(segments[i])
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts the query parameters by encoded name, then encoded
+// value. Sorting the joined 'name=value' strings instead would put 'a-b'
+// before 'a', since '-' sorts before '='.
+func canonicalQuery(parsedURL *url.URL) string {
+	var pairs [][2]string
+	for key, values := range parsedURL.Query() {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{uriEncode(key), uriEncode(value)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	joined := make([]string, len(pairs))
+	for i, pair := range pairs {
+		joined[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(joined, "&")
+}
+
+// uriEncode percent-encodes everything but the RFC 3986 unreserved characters.
+func uriEncode(text string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(text); i++ {
+		char := text[i]
+		if char >= 'A' && char <= 'Z' || char >= 'a' && char <= 'z' || char >= '0' && char <= '9' ||
+			char == '-' || char == '_' || char == '.' || char == '~' {
+			encoded.WriteByte(char)
+		} else {
+			encoded.WriteString(fmt.Sprintf("%%%02X", char))
+		}
+	}
+	return encoded.String()
+}
+
+// canonicalHeaderValue trims the value and collapses inner runs of spaces.
+func canonicalHeaderValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
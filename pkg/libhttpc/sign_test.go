@@ -0,0 +1,71 @@
+package libhttpc
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Requests and signatures of the AWS SigV4 test suite, signed on
+// 20150830T123600Z for us-east-1 and the service named "service".
+func TestSigV4TestSuite(t *testing.T) {
+	cases := []struct {
+		name      string
+		url       string
+		signature string
+	}{
+		{"get-vanilla", "https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"get-vanilla-query-order-key", "https://example.amazonaws.com/?Param1=value2&Param1=value1", "5772eed61e12b33fae39ee5e7012498b51d56abc0abb7c60486157bd471c4694"},
+		{"get-vanilla-query-order-value", "https://example.amazonaws.com/?Param1=value2&Param1=Value1", "eedbc4e291e521cf13422ffca22be7d2eb8146eecf653089df300a15b2382bd1"},
+	}
+	signer := &SigV4Signer{
+		Provider:  "aws",
+		Region:    "us-east-1",
+		Service:   "service",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	for _, c := range cases {
+		headers := RequestHeader{}
+		if err := signer.Sign("GET", c.url, headers, nil, now); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		want := " AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + c.signature
+		if headers["Authorization"] != want {
+			t.Errorf("%s:\n got %s\nwant %s", c.name, headers["Authorization"], want)
+		}
+	}
+}
+
+func TestHMACSignerSignature(t *testing.T) {
+	signer := &HMACSigner{KeyID: "key", Secret: "secret"}
+	headers := RequestHeader{"Content-Type": " application/json"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	if err := signer.Sign("POST", "http://example.com/path/a%20b?b=2&a-b=2&a=1", headers, []byte(`{"x":1}`), now); err != nil {
+		t.Fatal(err)
+	}
+	want := ` HMAC-SHA256 keyId="key",headers="host date content-type x-content-sha256",signature="WAGUyVA8kt/5RaqSR+opCxZScTDw+UM0OIE7lIo7SPU="`
+	if headers["Authorization"] != want {
+		t.Fatalf("got %s\nwant %s", headers["Authorization"], want)
+	}
+	if headers["X-Content-SHA256"] != " 5041bf1f713df204784353e82f6a4a535931cb64f1f4b4a5aeaffcb720918b22" {
+		t.Fatalf("X-Content-SHA256 = %q", headers["X-Content-SHA256"])
+	}
+}
+
+func TestCanonicalQuerySortsPairs(t *testing.T) {
+	cases := map[string]string{
+		"b=2&a=1":          "a=1&b=2",
+		"a=1&a-b=2":        "a=1&a-b=2",
+		"a=z&a=b&a=":       "a=&a=b&a=z",
+		"k=a%20b&k2=%2F+x": "k=a%20b&k2=%2F%20x",
+		"":                 "",
+	}
+	for query, want := range cases {
+		if got := canonicalQuery(&url.URL{RawQuery: query}); got != want {
+			t.Errorf("canonicalQuery(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package libhttpc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is one Server-Sent Event as defined by the HTML event stream format.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// EventStream reads a text/event-stream response incrementally and
+// reconnects with Last-Event-ID whenever the connection drops.
+type EventStream struct {
+	url         string
+	headers     RequestHeader
+	LastEventID string
+	RetryDelay  time.Duration
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	closed bool
+	// failures counts the reconnects since the last event
+	failures int
+}
+
+const DefaultRetryDelay = 3 * time.Second
+
+// Reconnects wait at least minRetryDelay, and back off by doubling up to
+// maxRetryDelay after every one that brought no event. They stop after
+// maxReconnects of those in a row.
+var minRetryDelay = 100 * time.Millisecond
+
+const maxRetryDelay = 30 * time.Second
+
+const maxReconnects = 8
+
+var ErrStreamClosed = errors.New("event stream closed")
+
+// errNoReconnect marks responses after which the stream must not reconnect.
+type errNoReconnect struct {
+	reason string
+}
+
+func (err *errNoReconnect) Error() string {
+	return err.reason
+}
+
+// OpenEventStream connects to an event stream. lastEventID may be empty.
+func OpenEventStream(inputUrl string, headers RequestHeader, lastEventID string) (*EventStream, error) {
+	stream := &EventStream{
+		url:         inputUrl,
+		headers:     headers,
+		LastEventID: lastEventID,
+		RetryDelay:  DefaultRetryDelay,
+	}
+	if err := stream.connect(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Next blocks until the next event. Dropped connections are re-established
+// after RetryDelay, backing off while they bring no event; it fails when the
+// server refuses the stream, reconnecting keeps failing or the stream is
+// closed.
+func (stream *EventStream) Next() (*Event, error) {
+	for {
+		stream.mutex.Lock()
+		reader, closed := stream.reader, stream.closed
+		stream.mutex.Unlock()
+		if closed {
+			return nil, ErrStreamClosed
+		}
+
+		if reader != nil {
+			event, err := stream.readEvent(reader)
+			if err == nil {
+				stream.failures = 0
+				return event, nil
+			}
+			stream.disconnect()
+			continue
+		}
+
+		if stream.failures >= maxReconnects {
+			return nil, fmt.Errorf("Event stream lost after %d reconnects without an event", stream.failures)
+		}
+		time.Sleep(stream.retryDelay())
+		stream.failures++
+		if err := stream.connect(); err != nil {
+			var refused *errNoReconnect
+			if errors.As(err, &refused) {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryDelay is RetryDelay, at least minRetryDelay, doubled for every
+// reconnect that brought no event.
+func (stream *EventStream) retryDelay() time.Duration {
+	delay := stream.RetryDelay
+	if delay < minRetryDelay {
+		delay = minRetryDelay
+	}
+	for i := 0; i < stream.failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+	return delay
+}
+
+func (stream *EventStream) Close() error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	stream.closed = true
+	if stream.conn != nil {
+		return stream.conn.Close()
+	}
+	return nil
+}
+
+func (stream *EventStream) connect() error {
+	headers := RequestHeader{}
+	for key, value := range stream.headers {
+		headers[key] = value
+	}
+	headers["Accept"] = "text/event-stream"
+	headers["Cache-Control"] = "no-cache"
+	if stream.LastEventID != BlankString {
+		headers["Last-Event-ID"] = stream.LastEventID
+	}
+	headers, err := prepareHeaders("GET", stream.url, headers)
+	if err != nil {
+		return err
+	}
+
+	parsedURL, parsedHeaders, conn, err := connectHandler(stream.url, headers)
+	if err != nil {
+		return err
+	}
+
+	requestString := fmt.Sprintf("GET %s %s%s%s%s",
+		parsedURL.RequestURI(), ProtocolVersion, CRLF, parsedHeaders, CRLF)
+	if _, err := conn.Write([]byte(requestString)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	var head strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		countReceived(len(line))
+		if line == CRLF || line == "\n" {
+			break
+		}
+		head.WriteString(line)
+	}
+
+	response, err := FromString(head.String() + CRLF)
+	if err != nil || response == nil {
+		conn.Close()
+		return &errNoReconnect{reason: "Malformed event stream response"}
+	}
+	// 204 is the server's way of asking clients to stop reconnecting
+	if response.StatusCode != 200 {
+		conn.Close()
+		return &errNoReconnect{reason: fmt.Sprintf("Event stream refused with status %d", response.StatusCode)}
+	}
+	if !strings.HasPrefix(strings.ToLower(response.Header("Content-Type")), "text/event-stream") {
+		conn.Close()
+		return &errNoReconnect{reason: "Response is not a text/event-stream"}
+	}
+
+	// the timeout bounds connecting only, an event stream stays open
+	_ = conn.SetDeadline(time.Time{})
+
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	if stream.closed {
+		conn.Close()
+		return ErrStreamClosed
+	}
+	stream.conn = conn
+	stream.reader = reader
+	return nil
+}
+
+func (stream *EventStream) disconnect() {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	if stream.conn != nil {
+		stream.conn.Close()
+	}
+	stream.conn = nil
+	stream.reader = nil
+}
+
+// readEvent consumes lines up to the blank line that dispatches an event.
+// Blocks without data only update the stream state and are skipped.
+func (stream *EventStream) readEvent(reader *bufio.Reader) (*Event, error) {
+	event := Event{}
+	var data strings.Builder
+	hasData := false
+
+	for {
+		line, err := reader.ReadString('\n')
+		countReceived(len(line))
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == BlankString {
+			if !hasData {
+				event = Event{}
+				continue
+			}
+			event.Data = strings.TrimSuffix(data.String(), "\n")
+			event.ID = stream.LastEventID
+			if event.Event == BlankString {
+				event.Event = "message"
+			}
+			return &event, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, BlankString
+		if colon := strings.Index(line, ":"); colon != -1 {
+			field = line[:colon]
+			value = strings.TrimPrefix(line[colon+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteString("\n")
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				stream.LastEventID = value
+			}
+		case "retry":
+			if milliseconds, err := strconv.Atoi(value); err == nil && milliseconds >= 0 {
+				event.Retry = time.Duration(milliseconds) * time.Millisecond
+				stream.RetryDelay = event.Retry
+			}
+		}
+	}
+}
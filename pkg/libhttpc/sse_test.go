@@ -0,0 +1,142 @@
+package libhttpc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadEvent(t *testing.T) {
+	input := ": a comment\n" +
+		"data: first\n" +
+		"data:  second\n" +
+		"data\n" +
+		"\n" +
+		"event: update\r\n" +
+		"id: 7\r\n" +
+		"data: {\"a\":1}\r\n" +
+		"\r\n" +
+		"id: 8\n" +
+		"retry: 250\n" +
+		"\n" +
+		"data: after\n" +
+		"\n" +
+		"id\n" +
+		"retry: soon\n" +
+		"unknown: field\n" +
+		"data: reset\n" +
+		"\n"
+	want := []Event{
+		{Event: "message", Data: "first\n second\n"},
+		{ID: "7", Event: "update", Data: `{"a":1}`},
+		{ID: "8", Event: "message", Data: "after"},
+		{Event: "message", Data: "reset"},
+	}
+
+	stream := &EventStream{RetryDelay: DefaultRetryDelay}
+	reader := bufio.NewReader(strings.NewReader(input))
+	for i, expected := range want {
+		event, err := stream.readEvent(reader)
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if *event != expected {
+			t.Errorf("event %d: got %+v, want %+v", i, *event, expected)
+		}
+	}
+	// the retry of a block without data still applies, an invalid one is ignored
+	if stream.RetryDelay != 250*time.Millisecond {
+		t.Errorf("retry delay %s, want 250ms", stream.RetryDelay)
+	}
+	if _, err := stream.readEvent(reader); err != io.ErrUnexpectedEOF {
+		t.Errorf("at the end: %v, want io.ErrUnexpectedEOF", err)
+	}
+	if _, err := stream.readEvent(bufio.NewReader(strings.NewReader("data: cut"))); err != io.ErrUnexpectedEOF {
+		t.Errorf("cut event: %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestEventStreamReconnectsWithLastEventID(t *testing.T) {
+	var mutex sync.Mutex
+	var lastEventIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		lastEventIDs = append(lastEventIDs, request.Header.Get("Last-Event-ID"))
+		count := len(lastEventIDs)
+		mutex.Unlock()
+		writer.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(writer, "retry: 0\nid: %d\ndata: event %d\n\n", count, count)
+	}))
+	defer server.Close()
+
+	stream, err := OpenEventStream(server.URL+"/events", RequestHeader{}, "start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	for i := 1; i <= 3; i++ {
+		event, err := stream.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Data != fmt.Sprintf("event %d", i) {
+			t.Fatalf("event %q, want event %d", event.Data, i)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if strings.Join(lastEventIDs, ",") != "start,1,2" {
+		t.Fatalf("Last-Event-ID %v, want start, 1 and 2", lastEventIDs)
+	}
+}
+
+func TestEventStreamBacksOffAndGivesUp(t *testing.T) {
+	defer func(original time.Duration) { minRetryDelay = original }(minRetryDelay)
+	minRetryDelay = time.Millisecond
+
+	var mutex sync.Mutex
+	var connects []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		connects = append(connects, time.Now())
+		first := len(connects) == 1
+		mutex.Unlock()
+		writer.Header().Set("Content-Type", "text/event-stream")
+		// only the first connection brings an event, and asks for no delay
+		if first {
+			fmt.Fprint(writer, "retry: 0\ndata: only\n\n")
+		}
+	}))
+	defer server.Close()
+
+	stream, err := OpenEventStream(server.URL+"/events", RequestHeader{}, BlankString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if event, err := stream.Next(); err != nil || event.Data != "only" {
+		t.Fatalf("got %v, %v, want the first event", event, err)
+	}
+	if _, err := stream.Next(); err == nil {
+		t.Fatal("want an error once reconnecting keeps failing")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(connects) != 1+maxReconnects {
+		t.Fatalf("%d connections, want %d", len(connects), 1+maxReconnects)
+	}
+	// every wait doubles the one before
+	for i := 2; i < len(connects); i++ {
+		want := minRetryDelay << uint(i-1)
+		if waited := connects[i].Sub(connects[i-1]); waited < want {
+			t.Fatalf("reconnect %d after %s, want at least %s", i, waited, want)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package libhttpc
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TestSpec is a suite of request cases with expectations, read from YAML.
+type TestSpec struct {
+	Name      string            `json:"name"`
+	BaseURL   string            `json:"base_url"`
+	Transport string            `json:"transport"`
+	Headers   map[string]string `json:"headers"`
+	Cases     []TestCase        `json:"cases"`
+}
+
+type TestCase struct {
+	Name    string      `json:"name"`
+	Request TestRequest `json:"request"`
+	Expect  TestExpect  `json:"expect"`
+}
+
+type TestRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// TestExpect lists the checks of a case; zero values are not checked. Body
+// is a regular expression, JSON maps JSONPath expressions to expected values
+// and MaxLatency is a duration such as "500ms".
+type TestExpect struct {
+	Status     int                    `json:"status"`
+	Headers    map[string]string      `json:"headers"`
+	Body       string                 `json:"body"`
+	JSON       map[string]interface{} `json:"json"`
+	MaxLatency string                 `json:"max_latency"`
+}
+
+// TestResult is the outcome of one case. Err is set when the request could
+// not be made at all, Failures lists the expectations that did not hold.
+type TestResult struct {
+	Name     string
+	Duration time.Duration
+	Failures []string
+	Err      error
+}
+
+func (result *TestResult) Passed() bool {
+	return result.Err == nil && len(result.Failures) == 0
+}
+
+// ParseTestSpec decodes a YAML test spec.
+func ParseTestSpec(content string) (*TestSpec, error) {
+	document, err := ParseYAML(content)
+	if err != nil {
+		return nil, err
+	}
+	// the YAML tree is re-decoded as JSON to fill the struct
+	encoded, err := json.Marshal(normalizeYAMLHeaders(document))
+	if err != nil {
+		return nil, err
+	}
+	spec := &TestSpec{}
+	if err := json.Unmarshal(encoded, spec); err != nil {
+		return nil, fmt.Errorf("Invalid test spec: %s", err.Error())
+	}
+	if len(spec.Cases) == 0 {
+		return nil, fmt.Errorf("Test spec has no cases")
+	}
+	for i := range spec.Cases {
+		testCase := &spec.Cases[i]
+		if testCase.Request.URL == BlankString {
+			return nil, fmt.Errorf("Test case %d has no request url", i+1)
+		}
+		if testCase.Name == BlankString {
+			testCase.Name = fmt.Sprintf("%s %s", strings.ToUpper(testCase.Request.method()), testCase.Request.URL)
+		}
+		if testCase.Expect.MaxLatency != BlankString {
+			if _, err := time.ParseDuration(testCase.Expect.MaxLatency); err != nil {
+				return nil, fmt.Errorf("Test case '%s': invalid max_latency '%s'", testCase.Name, testCase.Expect.MaxLatency)
+			}
+		}
+		if testCase.Expect.Body != BlankString {
+			if _, err := regexp.Compile(testCase.Expect.Body); err != nil {
+				return nil, fmt.Errorf("Test case '%s': invalid body pattern: %s", testCase.Name, err.Error())
+			}
+		}
+	}
+	return spec, nil
+}
+
+func ReadTestSpec(path string) (*TestSpec, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTestSpec(string(content))
+}
+
+// normalizeYAMLHeaders turns scalar values of header maps into strings, so
+// 'Content-Length: 12' decodes into a map[string]string.
+func normalizeYAMLHeaders(value interface{}) interface{} {
+	switch node := value.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			if key == "headers" {
+				if headers, ok := child.(map[string]interface{}); ok {
+					for name, header := range headers {
+						if header != nil {
+							headers[name] = fmt.Sprint(header)
+						}
+					}
+					continue
+				}
+			}
+			node[key] = normalizeYAMLHeaders(child)
+		}
+	case []interface{}:
+		for i, child := range node {
+			node[i] = normalizeYAMLHeaders(child)
+		}
+	}
+	return value
+}
+
+func (request *TestRequest) method() string {
+	if request.Method == BlankString {
+		return "GET"
+	}
+	return request.Method
+}
+
+// RunTestCase sends the case's request to url with the given headers over
+// transport and checks every expectation.
+func RunTestCase(testCase TestCase, transport string, url string, headers RequestHeader) TestResult {
+	result := TestResult{Name: testCase.Name}
+
+	started := time.Now()
+	raw, err := Send(transport, testCase.Request.method(), url, headers, []byte(testCase.Request.Body))
+	result.Duration = time.Since(started)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	response, err := FromString(raw)
+	if err == nil && response == nil {
+		err = fmt.Errorf("Malformed response")
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	expect := testCase.Expect
+	if expect.Status != 0 && response.StatusCode != expect.Status {
+		result.fail("status is %d, expected %d", response.StatusCode, expect.Status)
+	}
+
+	for _, name := range sortedKeys(expect.Headers) {
+		actual := strings.TrimSpace(response.Header(name))
+		if actual != strings.TrimSpace(expect.Headers[name]) {
+			result.fail("header %s is '%s', expected '%s'", name, actual, expect.Headers[name])
+		}
+	}
+
+	if expect.Body != BlankString {
+		if !regexp.MustCompile(expect.Body).MatchString(response.Body) {
+			result.fail("body does not match /%s/", expect.Body)
+		}
+	}
+
+	paths := make([]string, 0, len(expect.JSON))
+	for path := range expect.JSON {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		actual, err := EvaluateJSONPath(response.Body, path)
+		if err != nil {
+			result.fail("%s: %s", path, err.Error())
+			continue
+		}
+		if !jsonEqual(actual, expect.JSON[path]) {
+			result.fail("%s is %s, expected %s", path, compactJSON(actual), compactJSON(expect.JSON[path]))
+		}
+	}
+
+	if expect.MaxLatency != BlankString {
+		maxLatency, _ := time.ParseDuration(expect.MaxLatency)
+		if result.Duration > maxLatency {
+			result.fail("took %s, expected at most %s", result.Duration, maxLatency)
+		}
+	}
+	return result
+}
+
+func (result *TestResult) fail(format string, args ...interface{}) {
+	result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonEqual compares two values by their JSON meaning, so 3 equals 3.0 and
+// json.Number equals int.
+func jsonEqual(actual interface{}, expected interface{}) bool {
+	var left, right interface{}
+	if json.Unmarshal([]byte(compactJSON(actual)), &left) != nil {
+		return false
+	}
+	if json.Unmarshal([]byte(compactJSON(expected)), &right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func compactJSON(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",chardata"`
+}
+
+// JUnitReport renders results as JUnit XML, the format CI servers read.
+func JUnitReport(suiteName string, started time.Time, results []TestResult) ([]byte, error) {
+	suite := junitTestSuite{
+		Name:      suiteName,
+		Tests:     len(results),
+		Timestamp: started.Format("2006-01-02T15:04:05"),
+	}
+	var total time.Duration
+	for _, result := range results {
+		total += result.Duration
+		testCase := junitTestCase{
+			Name:      result.Name,
+			ClassName: suiteName,
+			Time:      seconds(result.Duration),
+		}
+		switch {
+		case result.Err != nil:
+			suite.Errors++
+			testCase.Error = &junitProblem{Message: result.Err.Error(), Type: "error", Details: result.Err.Error()}
+		case len(result.Failures) > 0:
+			suite.Failures++
+			testCase.Failure = &junitProblem{
+				Message: result.Failures[0],
+				Type:    "assertion",
+				Details: strings.Join(result.Failures, "\n"),
+			}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = seconds(total)
+
+	encoded, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(encoded, '\n')...), nil
+}
+
+func seconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
@@ -0,0 +1,102 @@
+package libhttpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTestSpec(t *testing.T) {
+	spec, err := ParseTestSpec(`name: users
+base_url: http://localhost:8080
+headers:
+  Accept: application/json
+cases:
+  - request:
+      url: /users/1
+    expect:
+      status: 200
+      headers:
+        Content-Length: 12
+      json:
+        $.id: 1
+        $.tags: [a, b]
+  - name: create
+    request:
+      method: POST
+      url: /users
+      body: |
+        {"name": "ann"}
+    expect:
+      body: created
+      max_latency: 500ms
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Name != "users" || spec.BaseURL != "http://localhost:8080" || spec.Headers["Accept"] != "application/json" {
+		t.Fatalf("spec %+v", spec)
+	}
+	if len(spec.Cases) != 2 {
+		t.Fatalf("%d cases, want 2", len(spec.Cases))
+	}
+	first, second := spec.Cases[0], spec.Cases[1]
+	if first.Name != "GET /users/1" {
+		t.Errorf("default name %q, want 'GET /users/1'", first.Name)
+	}
+	if first.Expect.Status != 200 || first.Expect.Headers["Content-Length"] != "12" {
+		t.Errorf("first expectations %+v", first.Expect)
+	}
+	if !jsonEqual(first.Expect.JSON["$.id"], 1) || !jsonEqual(first.Expect.JSON["$.tags"], []string{"a", "b"}) {
+		t.Errorf("json expectations %v", first.Expect.JSON)
+	}
+	if second.Name != "create" || second.Request.Method != "POST" || second.Request.Body != "{\"name\": \"ann\"}\n" {
+		t.Errorf("second case %+v", second)
+	}
+	if second.Expect.MaxLatency != "500ms" || second.Expect.Body != "created" {
+		t.Errorf("second expectations %+v", second.Expect)
+	}
+}
+
+func TestParseTestSpecErrors(t *testing.T) {
+	cases := map[string]string{
+		"no cases":    "name: empty\n",
+		"no url":      "cases:\n  - request:\n      method: GET\n",
+		"bad latency": "cases:\n  - request:\n      url: /\n    expect:\n      max_latency: soon\n",
+		"bad pattern": "cases:\n  - request:\n      url: /\n    expect:\n      body: '(unclosed'\n",
+	}
+	for name, content := range cases {
+		if _, err := ParseTestSpec(content); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func TestJUnitReport(t *testing.T) {
+	started := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	results := []TestResult{
+		{Name: "GET /ok", Duration: 120 * time.Millisecond},
+		{Name: "GET /missing", Duration: 30 * time.Millisecond, Failures: []string{"status is 404, expected 200", "body does not match /<ok>/"}},
+		{Name: "GET /down", Duration: 5 * time.Millisecond, Err: errors.New("connection refused")},
+	}
+	report, err := JUnitReport("api", started, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="api" tests="3" failures="1" errors="1" time="0.155" timestamp="2021-03-04T05:06:07">
+    <testcase name="GET /ok" classname="api" time="0.120"></testcase>
+    <testcase name="GET /missing" classname="api" time="0.030">
+      <failure message="status is 404, expected 200" type="assertion">status is 404, expected 200&#xA;body does not match /&lt;ok&gt;/</failure>
+    </testcase>
+    <testcase name="GET /down" classname="api" time="0.005">
+      <error message="connection refused" type="error">connection refused</error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if string(report) != want {
+		t.Fatalf("report:\n%s\nwant:\n%s", report, want)
+	}
+}
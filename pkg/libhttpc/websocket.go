@@ -0,0 +1,359 @@
+package libhttpc
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseNoStatus        = 1005
+	CloseMessageTooLarge = 1009
+)
+
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const maxWebSocketMessage = 64 * 1024 * 1024
+
+const maxControlPayload = 125
+
+// WebSocket is a client connection speaking RFC 6455 after the Upgrade
+// handshake. Reads must come from one goroutine; writes may come from any.
+type WebSocket struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	closeSent  bool
+	partial    *WebSocketMessage
+}
+
+type WebSocketMessage struct {
+	Opcode int
+	Data   []byte
+}
+
+// WebSocketCloseError is returned by ReadMessage once the peer closed the
+// connection.
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (err *WebSocketCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with code %d %s", err.Code, err.Reason)
+}
+
+// DialWebSocket connects to a ws:// or wss:// URL and performs the Upgrade
+// handshake.
+func DialWebSocket(inputUrl string, headers RequestHeader) (*WebSocket, error) {
+	parsedURL, err := url.Parse(inputUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	port := parsedURL.Port()
+	secure := false
+	switch parsedURL.Scheme {
+	case "ws", "http":
+		if port == BlankString {
+			port = "80"
+		}
+	case "wss", "https":
+		secure = true
+		if port == BlankString {
+			port = "443"
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported websocket scheme '%s'", parsedURL.Scheme)
+	}
+
+	headers, err = prepareHeaders("GET", inputUrl, headers)
+	if err != nil {
+		return nil, err
+	}
+	host := net.JoinHostPort(parsedURL.Hostname(), port)
+	conn, err := dialer("tcp", host, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if secure {
+		conn = tls.Client(conn, &tls.Config{ServerName: parsedURL.Hostname()})
+	}
+	conn = throttle(conn)
+
+	ws := &WebSocket{conn: conn, reader: bufio.NewReader(conn)}
+	if err := ws.handshake(parsedURL, headers); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (ws *WebSocket) handshake(parsedURL *url.URL, headers RequestHeader) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	upgradeHeaders := RequestHeader{}
+	for headerKey, headerValue := range headers {
+		upgradeHeaders[headerKey] = headerValue
+	}
+	upgradeHeaders["Host"] = parsedURL.Host
+	upgradeHeaders["Upgrade"] = "websocket"
+	upgradeHeaders["Connection"] = "Upgrade"
+	upgradeHeaders["Sec-WebSocket-Key"] = key
+	upgradeHeaders["Sec-WebSocket-Version"] = "13"
+
+	// the Upgrade mechanism only exists in HTTP/1.1
+	requestString := fmt.Sprintf("GET %s HTTP/1.1%s%s%s",
+		parsedURL.RequestURI(), CRLF, stringifyHeaders(upgradeHeaders), CRLF)
+
+	if requestTimeout > 0 {
+		_ = ws.conn.SetDeadline(time.Now().Add(requestTimeout))
+		defer ws.conn.SetDeadline(time.Time{})
+	}
+	if _, err := ws.conn.Write([]byte(requestString)); err != nil {
+		return err
+	}
+
+	var head strings.Builder
+	for {
+		line, err := ws.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if line == CRLF || line == "\n" {
+			break
+		}
+		head.WriteString(line)
+	}
+
+	response, err := FromString(head.String() + CRLF)
+	if err != nil {
+		return err
+	}
+	if response == nil || response.StatusCode != 101 {
+		statusLine := strings.TrimSpace(strings.SplitN(head.String(), "\n", 2)[0])
+		return fmt.Errorf("Server refused the websocket upgrade: %s", statusLine)
+	}
+
+	digest := sha1.Sum([]byte(key + webSocketGUID))
+	expected := base64.StdEncoding.EncodeToString(digest[:])
+	if response.Header("Sec-WebSocket-Accept") != expected {
+		return errors.New("Server sent an invalid Sec-WebSocket-Accept")
+	}
+	return nil
+}
+
+func (ws *WebSocket) WriteText(text string) error {
+	return ws.writeFrame(OpText, []byte(text))
+}
+
+func (ws *WebSocket) WriteBinary(data []byte) error {
+	return ws.writeFrame(OpBinary, data)
+}
+
+func (ws *WebSocket) Ping(data []byte) error {
+	return ws.writeFrame(OpPing, data)
+}
+
+func (ws *WebSocket) Pong(data []byte) error {
+	return ws.writeFrame(OpPong, data)
+}
+
+// Close starts the closing handshake. The peer's answer is still delivered
+// through ReadMessage as a WebSocketCloseError.
+func (ws *WebSocket) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	return ws.writeFrame(OpClose, payload)
+}
+
+// Shutdown drops the underlying connection without a closing handshake.
+func (ws *WebSocket) Shutdown() error {
+	return ws.conn.Close()
+}
+
+// ReadMessage returns the next text, binary or pong message, reassembling
+// fragments. Pings are answered automatically.
+func (ws *WebSocket) ReadMessage() (*WebSocketMessage, error) {
+	for {
+		final, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case OpPing:
+			if err := ws.Pong(payload); err != nil {
+				return nil, err
+			}
+		case OpPong:
+			return &WebSocketMessage{Opcode: OpPong, Data: payload}, nil
+		case OpClose:
+			closeErr := &WebSocketCloseError{Code: CloseNoStatus}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			ws.writeMutex.Lock()
+			sent := ws.closeSent
+			ws.writeMutex.Unlock()
+			if !sent {
+				// 1005 only reports a missing code and must not be sent
+				code := closeErr.Code
+				if code == CloseNoStatus {
+					code = CloseNormal
+				}
+				_ = ws.Close(code, BlankString)
+			}
+			ws.conn.Close()
+			return nil, closeErr
+		case OpText, OpBinary:
+			if ws.partial != nil {
+				return nil, ws.fail("new message started inside a fragmented message")
+			}
+			ws.partial = &WebSocketMessage{Opcode: opcode, Data: payload}
+		case OpContinuation:
+			if ws.partial == nil {
+				return nil, ws.fail("continuation frame without a message")
+			}
+			if len(ws.partial.Data)+len(payload) > maxWebSocketMessage {
+				_ = ws.Close(CloseMessageTooLarge, BlankString)
+				return nil, errors.New("websocket message too large")
+			}
+			ws.partial.Data = append(ws.partial.Data, payload...)
+		default:
+			return nil, ws.fail(fmt.Sprintf("unknown opcode %d", opcode))
+		}
+
+		if final && ws.partial != nil && opcode != OpPing {
+			message := ws.partial
+			ws.partial = nil
+			return message, nil
+		}
+	}
+}
+
+func (ws *WebSocket) fail(reason string) error {
+	_ = ws.Close(CloseProtocolError, BlankString)
+	ws.conn.Close()
+	return errors.New("websocket protocol error: " + reason)
+}
+
+func (ws *WebSocket) readFrame() (bool, int, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(ws.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+
+	final := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(ws.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(ws.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > maxWebSocketMessage {
+		_ = ws.Close(CloseMessageTooLarge, BlankString)
+		return false, 0, nil, errors.New("websocket frame too large")
+	}
+
+	mask := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return final, opcode, payload, nil
+}
+
+// writeFrame sends one unfragmented frame, masked as clients must.
+func (ws *WebSocket) writeFrame(opcode int, payload []byte) error {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+
+	if ws.closeSent {
+		return errors.New("websocket is closing")
+	}
+	if opcode == OpClose {
+		ws.closeSent = true
+	}
+
+	frame := []byte{0x80 | byte(opcode)}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame = append(frame, mask...)
+	start := len(frame)
+	frame = append(frame, payload...)
+	for i := range frame[start:] {
+		frame[start+i] ^= mask[i%4]
+	}
+
+	_, err := ws.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,217 @@
+package libhttpc
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wsPeer is the server side of a test connection. It reads frames the way
+// RFC 6455 requires from a client, masked, and writes them unmasked.
+type wsPeer struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (peer *wsPeer) readFrame() (bool, int, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(peer.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("client frame is not masked")
+	}
+	length := int(header[1] & 0x7F)
+	if length >= 126 {
+		return false, 0, nil, errors.New("unexpected extended length")
+	}
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(peer.reader, mask); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(peer.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return header[0]&0x80 != 0, int(header[0] & 0x0F), payload, nil
+}
+
+func (peer *wsPeer) expect(opcode int, payload string) error {
+	final, got, data, err := peer.readFrame()
+	if err != nil {
+		return err
+	}
+	if !final || got != opcode || string(data) != payload {
+		return fmt.Errorf("got frame final=%v opcode=%d %q, want opcode %d %q", final, got, data, opcode, payload)
+	}
+	return nil
+}
+
+func (peer *wsPeer) writeFrame(final bool, opcode int, payload string) error {
+	first := byte(opcode)
+	if final {
+		first |= 0x80
+	}
+	_, err := peer.conn.Write(append([]byte{first, byte(len(payload))}, payload...))
+	return err
+}
+
+// startWebSocketServer upgrades every request and runs script on the
+// connection, reporting its error on the returned channel.
+func startWebSocketServer(t *testing.T, script func(peer *wsPeer) error) (string, chan error) {
+	done := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Upgrade") != "websocket" || request.Header.Get("Sec-WebSocket-Version") != "13" {
+			http.Error(writer, "not a websocket handshake", http.StatusBadRequest)
+			done <- errors.New("bad handshake headers")
+			return
+		}
+		conn, buffered, err := writer.(http.Hijacker).Hijack()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		digest := sha1.Sum([]byte(request.Header.Get("Sec-WebSocket-Key") + webSocketGUID))
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			base64.StdEncoding.EncodeToString(digest[:]))
+		done <- script(&wsPeer{conn: conn, reader: buffered.Reader})
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http"), done
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	url, done := startWebSocketServer(t, func(peer *wsPeer) error {
+		if err := peer.expect(OpText, "hello world"); err != nil {
+			return err
+		}
+		// echo it back in three fragments with a ping between them
+		for _, frame := range []struct {
+			final   bool
+			opcode  int
+			payload string
+		}{
+			{false, OpText, "hello "},
+			{true, OpPing, "p1"},
+			{false, OpContinuation, "wor"},
+			{true, OpContinuation, "ld"},
+		} {
+			if err := peer.writeFrame(frame.final, frame.opcode, frame.payload); err != nil {
+				return err
+			}
+		}
+		if err := peer.expect(OpPong, "p1"); err != nil {
+			return err
+		}
+		if err := peer.expect(OpPing, "p2"); err != nil {
+			return err
+		}
+		if err := peer.writeFrame(true, OpPong, "p2"); err != nil {
+			return err
+		}
+		closing := make([]byte, 2)
+		binary.BigEndian.PutUint16(closing, CloseNormal)
+		if err := peer.expect(OpClose, string(closing)+"bye"); err != nil {
+			return err
+		}
+		return peer.writeFrame(true, OpClose, string(closing))
+	})
+
+	ws, err := DialWebSocket(url, RequestHeader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Shutdown()
+	if err := ws.WriteText("hello world"); err != nil {
+		t.Fatal(err)
+	}
+	message, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Opcode != OpText || string(message.Data) != "hello world" {
+		t.Fatalf("message %d %q, want the reassembled text", message.Opcode, message.Data)
+	}
+
+	if err := ws.Ping([]byte("p2")); err != nil {
+		t.Fatal(err)
+	}
+	if message, err = ws.ReadMessage(); err != nil || message.Opcode != OpPong || string(message.Data) != "p2" {
+		t.Fatalf("got %v %v, want the pong", message, err)
+	}
+
+	if err := ws.Close(CloseNormal, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ws.ReadMessage()
+	var closeErr *WebSocketCloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseNormal {
+		t.Fatalf("got %v, want the close answer", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebSocketAnswersServerClose(t *testing.T) {
+	url, done := startWebSocketServer(t, func(peer *wsPeer) error {
+		// a close without a status code is answered with 1000
+		if err := peer.writeFrame(true, OpClose, BlankString); err != nil {
+			return err
+		}
+		closing := make([]byte, 2)
+		binary.BigEndian.PutUint16(closing, CloseNormal)
+		return peer.expect(OpClose, string(closing))
+	})
+
+	ws, err := DialWebSocket(url, RequestHeader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ws.ReadMessage()
+	var closeErr *WebSocketCloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseNoStatus {
+		t.Fatalf("got %v, want a close without status", err)
+	}
+	if err := ws.WriteText("late"); err == nil {
+		t.Fatal("wrote after the closing handshake")
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebSocketRejectsBadContinuation(t *testing.T) {
+	url, done := startWebSocketServer(t, func(peer *wsPeer) error {
+		if err := peer.writeFrame(true, OpContinuation, "orphan"); err != nil {
+			return err
+		}
+		closing := make([]byte, 2)
+		binary.BigEndian.PutUint16(closing, CloseProtocolError)
+		return peer.expect(OpClose, string(closing))
+	})
+
+	ws, err := DialWebSocket(url, RequestHeader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.ReadMessage(); err == nil || !strings.Contains(err.Error(), "protocol error") {
+		t.Fatalf("got %v, want a protocol error", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,395 @@
+package libhttpc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseYAML decodes the block-style subset of YAML used by test specs:
+// mappings, sequences, plain and quoted scalars, '|' and '>' block scalars,
+// flow sequences and mappings of scalars, and comments. Anchors, tags and
+// multiple documents are not supported. Mappings decode to
+// map[string]interface{}, sequences to []interface{}, and scalars to string,
+// int, float64, bool or nil.
+func ParseYAML(content string) (interface{}, error) {
+	parser := &yamlParser{}
+	for number, raw := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if number == 0 && strings.TrimSpace(raw) == "---" {
+			raw = BlankString
+		}
+		if strings.HasPrefix(raw, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs cannot be used for indentation", number+1)
+		}
+		parser.lines = append(parser.lines, &yamlLine{raw: raw, number: number + 1})
+	}
+	for _, line := range parser.lines {
+		text := stripYAMLComment(line.raw)
+		line.indent = len(text) - len(strings.TrimLeft(text, " "))
+		line.text = strings.TrimSpace(text)
+	}
+
+	parser.skipBlank()
+	if parser.done() {
+		return nil, nil
+	}
+	value, err := parser.parseNode(parser.current().indent)
+	if err != nil {
+		return nil, err
+	}
+	parser.skipBlank()
+	if !parser.done() {
+		return nil, parser.errorf("unexpected content '%s'", parser.current().text)
+	}
+	return value, nil
+}
+
+type yamlLine struct {
+	raw    string
+	text   string
+	indent int
+	number int
+}
+
+type yamlParser struct {
+	lines    []*yamlLine
+	position int
+}
+
+func (parser *yamlParser) done() bool {
+	return parser.position >= len(parser.lines)
+}
+
+func (parser *yamlParser) current() *yamlLine {
+	return parser.lines[parser.position]
+}
+
+func (parser *yamlParser) skipBlank() {
+	for !parser.done() && parser.current().text == BlankString {
+		parser.position++
+	}
+}
+
+func (parser *yamlParser) errorf(format string, args ...interface{}) error {
+	number := 0
+	if !parser.done() {
+		number = parser.current().number
+	} else if len(parser.lines) > 0 {
+		number = parser.lines[len(parser.lines)-1].number
+	}
+	return fmt.Errorf("yaml line %d: %s", number, fmt.Sprintf(format, args...))
+}
+
+// parseNode parses the block starting at the current line, whose
+// indentation is indent.
+func (parser *yamlParser) parseNode(indent int) (interface{}, error) {
+	line := parser.current()
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return parser.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return parser.parseMapping(indent)
+	}
+	parser.position++
+	return parseYAMLScalar(line.text)
+}
+
+func (parser *yamlParser) parseSequence(indent int) (interface{}, error) {
+	sequence := []interface{}{}
+	for {
+		parser.skipBlank()
+		if parser.done() {
+			return sequence, nil
+		}
+		line := parser.current()
+		isEntry := line.text == "-" || strings.HasPrefix(line.text, "- ")
+		// a sequence nested in a mapping may share the mapping's indentation
+		if line.indent < indent || (line.indent == indent && !isEntry) {
+			return sequence, nil
+		}
+		if line.indent > indent || !isEntry {
+			return nil, parser.errorf("bad indentation of a sequence entry")
+		}
+
+		rest := strings.TrimPrefix(line.text, "-")
+		trimmed := strings.TrimLeft(rest, " ")
+		if trimmed == BlankString {
+			parser.position++
+			value, err := parser.parseChild(indent, true)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+			continue
+		}
+
+		// '- key: value' opens a mapping indented to the key
+		line.indent += 1 + len(rest) - len(trimmed)
+		line.text = trimmed
+		value, err := parser.parseNode(line.indent)
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+	}
+}
+
+func (parser *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := map[string]interface{}{}
+	for {
+		parser.skipBlank()
+		if parser.done() {
+			return mapping, nil
+		}
+		line := parser.current()
+		if line.indent < indent {
+			return mapping, nil
+		}
+		if line.indent > indent {
+			return nil, parser.errorf("bad indentation of a mapping entry")
+		}
+
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, parser.errorf("expected 'key: value', found '%s'", line.text)
+		}
+		if _, exists := mapping[key]; exists {
+			return nil, parser.errorf("duplicate key '%s'", key)
+		}
+
+		switch {
+		case value == BlankString:
+			parser.position++
+			child, err := parser.parseChild(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			mapping[key] = child
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			parser.position++
+			mapping[key] = parser.parseBlockScalar(indent, value)
+		default:
+			scalar, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, parser.errorf("%s", err.Error())
+			}
+			parser.position++
+			mapping[key] = scalar
+		}
+	}
+}
+
+// parseChild parses the value of an entry whose content starts on the next
+// line. A mapping value may be a sequence at the same indentation.
+func (parser *yamlParser) parseChild(indent int, inSequence bool) (interface{}, error) {
+	parser.skipBlank()
+	if parser.done() {
+		return nil, nil
+	}
+	line := parser.current()
+	if line.indent > indent {
+		return parser.parseNode(line.indent)
+	}
+	if !inSequence && line.indent == indent && (line.text == "-" || strings.HasPrefix(line.text, "- ")) {
+		return parser.parseSequence(indent)
+	}
+	return nil, nil
+}
+
+// parseBlockScalar reads the raw lines of a '|' (literal) or '>' (folded)
+// scalar. '-' strips the final newline.
+func (parser *yamlParser) parseBlockScalar(indent int, header string) string {
+	var lines []string
+	blockIndent := -1
+	for !parser.done() {
+		raw := parser.current().raw
+		content := strings.TrimLeft(raw, " ")
+		if content == BlankString {
+			lines = append(lines, BlankString)
+			parser.position++
+			continue
+		}
+		rawIndent := len(raw) - len(content)
+		if rawIndent <= indent {
+			break
+		}
+		if blockIndent == -1 {
+			blockIndent = rawIndent
+		}
+		if rawIndent < blockIndent {
+			break
+		}
+		lines = append(lines, raw[blockIndent:])
+		parser.position++
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == BlankString {
+		lines = lines[:len(lines)-1]
+	}
+
+	var text string
+	if strings.HasPrefix(header, ">") {
+		var folded strings.Builder
+		for i, line := range lines {
+			switch {
+			case i == 0, lines[i-1] == BlankString:
+			case line == BlankString:
+				folded.WriteString("\n")
+			default:
+				folded.WriteString(" ")
+			}
+			folded.WriteString(line)
+		}
+		text = folded.String()
+	} else {
+		text = strings.Join(lines, "\n")
+	}
+	if !strings.Contains(header, "-") && text != BlankString {
+		text += "\n"
+	}
+	return text
+}
+
+// splitYAMLKey splits 'key: value' at the first ': ' outside quotes.
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return BlankString, BlankString, false
+	}
+	quote := rune(0)
+	for i, char := range text {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case (char == '"' || char == '\'') && i == 0:
+			quote = char
+		case char == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if strings.HasPrefix(key, "\"") || strings.HasPrefix(key, "'") {
+				unquoted, err := parseYAMLScalar(key)
+				if err != nil {
+					return BlankString, BlankString, false
+				}
+				key = fmt.Sprint(unquoted)
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return BlankString, BlankString, false
+}
+
+// stripYAMLComment removes a '#' comment that starts a line or follows a
+// space, unless it is inside quotes.
+func stripYAMLComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		char := line[i]
+		switch {
+		case quote == '\'' && char == '\'' && i+1 < len(line) && line[i+1] == '\'':
+			// '' and \" escape the quote instead of closing the string
+			i++
+		case quote == '"' && char == '\\':
+			i++
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			if i == 0 || strings.ContainsRune(" :-[{,", rune(line[i-1])) {
+				quote = char
+			}
+		case char == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseYAMLScalar(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "\""):
+		if len(text) < 2 || !strings.HasSuffix(text, "\"") {
+			return nil, fmt.Errorf("unterminated double quoted string %s", text)
+		}
+		return strconv.Unquote(text)
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("unterminated single quoted string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		return parseYAMLFlow(text, "[", "]")
+	case strings.HasPrefix(text, "{"):
+		return parseYAMLFlow(text, "{", "}")
+	}
+
+	switch text {
+	case BlankString, "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if number, err := strconv.Atoi(text); err == nil {
+		return number, nil
+	}
+	if number, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXnN") {
+		return number, nil
+	}
+	return text, nil
+}
+
+// parseYAMLFlow parses '[a, b]' and '{a: 1, b: 2}' holding scalars only.
+func parseYAMLFlow(text string, open string, close string) (interface{}, error) {
+	if !strings.HasSuffix(text, close) {
+		return nil, fmt.Errorf("unterminated flow collection %s", text)
+	}
+	inner := strings.TrimSpace(text[len(open) : len(text)-len(close)])
+	var items []string
+	if inner != BlankString {
+		start, quote := 0, rune(0)
+		for i, char := range inner {
+			switch {
+			case quote != 0:
+				if char == quote {
+					quote = 0
+				}
+			case char == '"' || char == '\'':
+				quote = char
+			case char == '[' || char == '{':
+				return nil, fmt.Errorf("nested flow collections are not supported: %s", text)
+			case char == ',':
+				items = append(items, strings.TrimSpace(inner[start:i]))
+				start = i + 1
+			}
+		}
+		items = append(items, strings.TrimSpace(inner[start:]))
+	}
+
+	if open == "[" {
+		sequence := []interface{}{}
+		for _, item := range items {
+			value, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+		}
+		return sequence, nil
+	}
+
+	mapping := map[string]interface{}{}
+	for _, item := range items {
+		key, value, ok := splitYAMLKey(item)
+		if !ok {
+			return nil, fmt.Errorf("expected 'key: value' in %s", text)
+		}
+		scalar, err := parseYAMLScalar(value)
+		if err != nil {
+			return nil, err
+		}
+		mapping[key] = scalar
+	}
+	return mapping, nil
+}
@@ -0,0 +1,72 @@
+package libhttpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    interface{}
+	}{
+		{"empty", "# only a comment\n", nil},
+		{"scalars", "---\nint: 12\nfloat: 1.5\nyes: true\nno: False\nnothing: ~\nword: hello world\nhex: 0x1F\n", map[string]interface{}{
+			"int": 12, "float": 1.5, "yes": true, "no": false, "nothing": nil, "word": "hello world", "hex": "0x1F",
+		}},
+		{"quoted", "double: \"a \\\"b\\\"\\n# c\"\nsingle: 'it''s # not a comment'\n\"quoted key\": 1\nnumber: \"12\"\n", map[string]interface{}{
+			"double": "a \"b\"\n# c", "single": "it's # not a comment", "quoted key": 1, "number": "12",
+		}},
+		{"comments", "# header\nkey: value # trailing\n\n  # indented\nurl: http://host/#anchor\n", map[string]interface{}{
+			"key": "value", "url": "http://host/#anchor",
+		}},
+		{"block collections", "cases:\n  - name: first\n    tags:\n    - a\n    - b\n  -\n    name: second\n  - plain\n", map[string]interface{}{
+			"cases": []interface{}{
+				map[string]interface{}{"name": "first", "tags": []interface{}{"a", "b"}},
+				map[string]interface{}{"name": "second"},
+				"plain",
+			},
+		}},
+		{"flow collections", "list: [1, 'two, three', \"four\", ]\nempty: []\nmap: {a: 1, 'b c': x}\n", map[string]interface{}{
+			"list":  []interface{}{1, "two, three", "four", nil},
+			"empty": []interface{}{},
+			"map":   map[string]interface{}{"a": 1, "b c": "x"},
+		}},
+		{"literal block", "body: |\n  {\n    \"a\": 1\n  }\n\nnext: 1\n", map[string]interface{}{
+			"body": "{\n  \"a\": 1\n}\n", "next": 1,
+		}},
+		{"stripped literal block", "body: |-\n  line one\n  line two\n", map[string]interface{}{
+			"body": "line one\nline two",
+		}},
+		{"folded block", "text: >\n  folded\n  lines\n\n  new paragraph\n", map[string]interface{}{
+			"text": "folded lines\nnew paragraph\n",
+		}},
+	}
+	for _, c := range cases {
+		got, err := ParseYAML(c.content)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s:\n got %#v\nwant %#v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	cases := map[string]string{
+		"tab":             "key:\n\tvalue: 1\n",
+		"duplicate key":   "a: 1\na: 2\n",
+		"unterminated":    "a: \"open\n",
+		"nested flow":     "a: [1, [2]]\n",
+		"bad indentation": "a:\n    b: 1\n  c: 2\n",
+		"not a mapping":   "a: 1\njust text\n",
+	}
+	for name, content := range cases {
+		if value, err := ParseYAML(content); err == nil {
+			t.Errorf("%s: got %#v, want an error", name, value)
+		}
+	}
+}
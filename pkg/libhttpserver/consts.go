@@ -9,6 +9,12 @@ Default is the current directory when launching the application.`
 
 const HelpTextPort = `Specifies the port number that the server will listen and serve at. Default is 8080.`
 
+const HelpTextCongestion = `Specifies the congestion control of the server, reno, cubic or none. Default is reno.`
+
+const HelpTextCwndTrace = `Specifies a CSV file to write the congestion window of every connection to.`
+
+const HelpTextWindow = `Specifies how many packets the server sends ahead of the oldest unacknowledged one. Default is 64.`
+
 const buffSize = 1024
 const blankString = ""
 
@@ -41,20 +47,5 @@ type Request struct {
 	Body    *string
 }
 
-type UDPPacket struct {
-	pType    []byte
-	seqNo    []byte
-	peerAddr []byte
-	peerPort []byte
-	payload  []byte
-}
-
-type Receiver struct {
-	expectedPacketNum     uint32
-	lastReceivedPacketNum uint32
-	receiverWindow        []UDPPacket
-	naks                  []uint32
-}
-
 var routeMap = map[string]map[string]handlerFn{}
 var verboseLogging bool
@@ -0,0 +1,200 @@
+package rudp
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// CongestionControl sizes the congestion window of a sender, in packets.
+// The connection sends no more than the smaller of it and its window.
+type CongestionControl interface {
+	// Window is the congestion window.
+	Window() float64
+	// Threshold is the slow start threshold.
+	Threshold() float64
+	// OnAck is called for every packet acknowledged for the first time.
+	OnAck(now time.Time)
+	// OnLoss is called once per window of data when a NAK reports a loss.
+	OnLoss(now time.Time)
+	// OnTimeout is called when a retransmission timer runs out.
+	OnTimeout(now time.Time)
+}
+
+// Congestion control algorithms ParseCongestion knows.
+const (
+	CongestionReno  = "reno"
+	CongestionCubic = "cubic"
+	CongestionNone  = "none"
+)
+
+const (
+	// initialCwnd is about 4KB, as RFC 3390 allows.
+	initialCwnd = 4
+	minCwnd     = 2
+	// initialThreshold lets slow start run until the first loss.
+	initialThreshold = math.MaxInt32
+)
+
+// ParseCongestion returns the constructor of the named algorithm.
+func ParseCongestion(name string) (func() CongestionControl, error) {
+	switch name {
+	case CongestionReno:
+		return NewReno, nil
+	case CongestionCubic:
+		return NewCubic, nil
+	case CongestionNone:
+		return NewFixedWindow, nil
+	}
+	return nil, fmt.Errorf("Unknown congestion control '%s', expected reno, cubic or none", name)
+}
+
+// Reno grows the window by a packet per ACK in slow start and by a packet
+// per window in congestion avoidance, halves it on loss and restarts slow
+// start from one packet on timeout.
+type Reno struct {
+	cwnd     float64
+	ssthresh float64
+}
+
+func NewReno() CongestionControl {
+	return &Reno{cwnd: initialCwnd, ssthresh: initialThreshold}
+}
+
+func (reno *Reno) Window() float64    { return reno.cwnd }
+func (reno *Reno) Threshold() float64 { return reno.ssthresh }
+
+func (reno *Reno) OnAck(now time.Time) {
+	if reno.cwnd < reno.ssthresh {
+		reno.cwnd++
+	} else {
+		reno.cwnd += 1 / reno.cwnd
+	}
+}
+
+func (reno *Reno) OnLoss(now time.Time) {
+	reno.ssthresh = math.Max(reno.cwnd/2, minCwnd)
+	reno.cwnd = reno.ssthresh
+}
+
+func (reno *Reno) OnTimeout(now time.Time) {
+	reno.ssthresh = math.Max(reno.cwnd/2, minCwnd)
+	reno.cwnd = 1
+}
+
+// CUBIC constants of RFC 8312. cubicAlpha makes the TCP-friendly estimate
+// grow as fast as Reno does for the same average window.
+const (
+	cubicC     = 0.4
+	cubicBeta  = 0.7
+	cubicAlpha = 3 * (1 - cubicBeta) / (1 + cubicBeta)
+)
+
+// Cubic is CUBIC as in RFC 8312: after a loss the window follows a cubic
+// function of the time since, flat around the window the loss happened at,
+// but never grows slower than Reno would.
+type Cubic struct {
+	cwnd     float64
+	ssthresh float64
+	maxCwnd  float64
+	epoch    time.Time
+	k        float64
+	// renoCwnd is the window Reno would have, counted per ACK
+	renoCwnd float64
+}
+
+func NewCubic() CongestionControl {
+	return &Cubic{cwnd: initialCwnd, ssthresh: initialThreshold}
+}
+
+func (cubic *Cubic) Window() float64    { return cubic.cwnd }
+func (cubic *Cubic) Threshold() float64 { return cubic.ssthresh }
+
+func (cubic *Cubic) OnAck(now time.Time) {
+	if cubic.cwnd < cubic.ssthresh {
+		cubic.cwnd++
+		return
+	}
+	if cubic.epoch.IsZero() {
+		cubic.epoch = now
+		cubic.maxCwnd = math.Max(cubic.maxCwnd, cubic.cwnd)
+		cubic.k = math.Cbrt((cubic.maxCwnd - cubic.cwnd) / cubicC)
+		cubic.renoCwnd = cubic.cwnd
+	}
+	elapsed := now.Sub(cubic.epoch).Seconds() - cubic.k
+	target := cubicC*elapsed*elapsed*elapsed + cubic.maxCwnd
+	cubic.renoCwnd += cubicAlpha / cubic.cwnd
+	if cubic.renoCwnd > target {
+		target = cubic.renoCwnd
+	}
+	if target > cubic.cwnd {
+		cubic.cwnd += (target - cubic.cwnd) / cubic.cwnd
+	} else {
+		cubic.cwnd += 0.01 / cubic.cwnd
+	}
+}
+
+func (cubic *Cubic) OnLoss(now time.Time) {
+	cubic.reduce()
+	cubic.cwnd = cubic.ssthresh
+}
+
+func (cubic *Cubic) OnTimeout(now time.Time) {
+	cubic.reduce()
+	cubic.cwnd = 1
+}
+
+func (cubic *Cubic) reduce() {
+	cubic.maxCwnd = cubic.cwnd
+	cubic.ssthresh = math.Max(cubic.cwnd*cubicBeta, minCwnd)
+	cubic.epoch = time.Time{}
+}
+
+// FixedWindow leaves the window to the connection, to compare with.
+type FixedWindow struct{}
+
+func NewFixedWindow() CongestionControl {
+	return FixedWindow{}
+}
+
+func (FixedWindow) Window() float64     { return math.MaxInt32 }
+func (FixedWindow) Threshold() float64  { return math.MaxInt32 }
+func (FixedWindow) OnAck(time.Time)     {}
+func (FixedWindow) OnLoss(time.Time)    {}
+func (FixedWindow) OnTimeout(time.Time) {}
+
+// Trace writes the congestion window of connections as CSV, one line per
+// ACK, loss or timeout that changes it. ssthresh is 0 until the first loss.
+// It may be shared by connections.
+type Trace struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	start  time.Time
+	header bool
+}
+
+func NewTrace(writer io.Writer) *Trace {
+	return &Trace{writer: writer, start: time.Now()}
+}
+
+func (trace *Trace) log(conn *Conn, event string) {
+	if trace == nil {
+		return
+	}
+	trace.mutex.Lock()
+	defer trace.mutex.Unlock()
+	if !trace.header {
+		trace.header = true
+		fmt.Fprintln(trace.writer, "time_ms,peer,event,cwnd,ssthresh,in_flight,srtt_ms,rto_ms")
+	}
+	threshold := conn.congestion.Threshold()
+	if threshold >= initialThreshold {
+		threshold = 0
+	}
+	fmt.Fprintf(trace.writer, "%.3f,%s,%s,%.2f,%.2f,%d,%.3f,%.3f\n",
+		float64(time.Since(trace.start).Microseconds())/1000, conn.peer, event,
+		conn.congestion.Window(), threshold, len(conn.inFlight),
+		float64(conn.stats.SRTT.Microseconds())/1000, float64(conn.stats.RTO.Microseconds())/1000)
+}
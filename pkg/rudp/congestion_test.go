@@ -0,0 +1,114 @@
+package rudp
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenoWindow(t *testing.T) {
+	reno := NewReno()
+	now := time.Now()
+	for i := 0; i < 12; i++ {
+		reno.OnAck(now)
+	}
+	if reno.Window() != initialCwnd+12 {
+		t.Fatalf("slow start: cwnd %.2f, want %d", reno.Window(), initialCwnd+12)
+	}
+
+	reno.OnLoss(now)
+	if reno.Window() != 8 || reno.Threshold() != 8 {
+		t.Fatalf("after a loss: cwnd %.2f ssthresh %.2f, want 8 and 8", reno.Window(), reno.Threshold())
+	}
+	// a window of ACKs grows it by one packet in congestion avoidance
+	for i := 0; i < 8; i++ {
+		reno.OnAck(now)
+	}
+	if reno.Window() < 8.9 || reno.Window() > 9 {
+		t.Fatalf("congestion avoidance: cwnd %.2f, want about 9", reno.Window())
+	}
+
+	reno.OnTimeout(now)
+	if reno.Window() != 1 || math.Abs(reno.Threshold()-4.5) > 0.1 {
+		t.Fatalf("after a timeout: cwnd %.2f ssthresh %.2f, want 1 and about 4.5", reno.Window(), reno.Threshold())
+	}
+	for i := 0; i < 2; i++ {
+		reno.OnTimeout(now)
+	}
+	if reno.Threshold() != minCwnd {
+		t.Fatalf("ssthresh %.2f, want no less than %d", reno.Threshold(), minCwnd)
+	}
+}
+
+func TestCubicWindow(t *testing.T) {
+	cubic := NewCubic()
+	start := time.Now()
+	for i := 0; i < 96; i++ {
+		cubic.OnAck(start)
+	}
+	if cubic.Window() != 100 {
+		t.Fatalf("slow start: cwnd %.2f, want 100", cubic.Window())
+	}
+
+	cubic.OnLoss(start)
+	if math.Abs(cubic.Window()-100*cubicBeta) > 1e-9 {
+		t.Fatalf("after a loss: cwnd %.2f, want %.2f", cubic.Window(), 100*cubicBeta)
+	}
+
+	// the window climbs back to where the loss happened after K seconds and
+	// stays close to it, then grows past it
+	k := math.Cbrt(100 * (1 - cubicBeta) / cubicC)
+	now := start
+	ackUntil := func(until time.Duration) {
+		for ; now.Sub(start) < until; now = now.Add(time.Millisecond) {
+			cubic.OnAck(now)
+		}
+	}
+	ackUntil(time.Duration(k * 0.5 * float64(time.Second)))
+	if window := cubic.Window(); window <= 100*cubicBeta || window >= 100 {
+		t.Fatalf("halfway to K: cwnd %.2f, want between %.2f and 100", window, 100*cubicBeta)
+	}
+	ackUntil(time.Duration(k * float64(time.Second)))
+	if window := cubic.Window(); math.Abs(window-100) > 2 {
+		t.Fatalf("at K: cwnd %.2f, want about 100", window)
+	}
+	ackUntil(time.Duration(2 * k * float64(time.Second)))
+	if window := cubic.Window(); window <= 105 {
+		t.Fatalf("past K: cwnd %.2f, want above 105", window)
+	}
+
+	cubic.OnTimeout(now)
+	if cubic.Window() != 1 {
+		t.Fatalf("after a timeout: cwnd %.2f, want 1", cubic.Window())
+	}
+}
+
+func TestParseCongestion(t *testing.T) {
+	for _, name := range []string{CongestionReno, CongestionCubic, CongestionNone} {
+		if _, err := ParseCongestion(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := ParseCongestion("vegas"); err == nil {
+		t.Error("vegas: want an error")
+	}
+}
+
+func TestTraceWritesCSV(t *testing.T) {
+	var out bytes.Buffer
+	conn := unconnected(t)
+	conn.trace = NewTrace(&out)
+	conn.mutex.Lock()
+	conn.congestionEvent("loss")
+	conn.mutex.Unlock()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || lines[0] != "time_ms,peer,event,cwnd,ssthresh,in_flight,srtt_ms,rto_ms" {
+		t.Fatalf("trace:\n%s", out.String())
+	}
+	if fields := strings.Split(lines[1], ","); len(fields) != 8 || fields[2] != "loss" || fields[3] != "2.00" {
+		t.Fatalf("line %q, want a loss with cwnd 2.00", lines[1])
+	}
+}
@@ -0,0 +1,655 @@
+package rudp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var ErrClosed = errors.New("rudp: use of closed connection")
+
+// ErrPeerUnreachable is returned once a packet went unacknowledged through
+// every retransmission.
+var ErrPeerUnreachable = errors.New("rudp: peer stopped acknowledging")
+
+// timeoutError is returned when a deadline passes, as net.Conn requires.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "rudp: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// DefaultWindow is the send window used when none is configured.
+const DefaultWindow = 64
+
+const (
+	// maxRetransmits gives up on the peer after that many timeouts in a row.
+	maxRetransmits = 10
+	// handshakeTimeout is how long a connection may take to be established.
+	handshakeTimeout = initialRTO * maxRetransmits
+	// maxOutOfOrder bounds the packets buffered ahead of a gap, whatever
+	// window the peer sends with.
+	maxOutOfOrder = 4096
+	// timerInterval is how often retransmission timers are checked.
+	timerInterval = 20 * time.Millisecond
+)
+
+// segment is a sent packet kept until it is acknowledged.
+type segment struct {
+	kind        byte
+	seq         uint32
+	payload     []byte
+	sentAt      time.Time
+	retransmits int
+	// retransmitted packets give no round-trip time sample (Karn)
+	retransmitted bool
+	nacked        bool
+	// lost packets wait for the congestion window to be sent again
+	lost bool
+}
+
+// Conn is a reliable, ordered byte stream over UDP, normally through the
+// router, using Selective Repeat. At most a window of packets past the
+// oldest unacknowledged one is outstanding, and no more packets than the
+// congestion window allows. Every packet received is
+// acknowledged on its own, along with the next sequence number expected, and
+// gaps are reported with NAKs. A packet is lost once it is overdue and was
+// NAKed or passed by an acknowledged packet sent after it, and it is sent
+// again as the congestion window allows. The newest packet is sent again
+// to probe for losses when nothing was acknowledged for a while. When the
+// timer of the oldest packet runs out, after a timeout estimated from the
+// round-trip time, it is sent again at once and the others are lost.
+// Close sends a FIN, which ends the stream, once all data is
+// acknowledged. Sequence numbers start at a random value and wrap around,
+// so a connection carries any amount of data.
+type Conn struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	peer    *net.UDPAddr
+	local   net.Addr
+	send    func(data []byte) error
+	release func()
+
+	established bool
+	onEstablish func(conn *Conn)
+	synAck      *packet
+
+	handshakeSentAt  time.Time
+	handshakeRetried bool
+	// handshakeResendAt is when an unanswered SYN-ACK is sent again
+	handshakeResendAt time.Time
+	// a connection not established by handshakeDeadline fails, so half-open
+	// ones do not stay in the listener
+	handshakeDeadline time.Time
+	stats             Stats
+
+	window     int
+	congestion CongestionControl
+	trace      *Trace
+	inRecovery bool
+	recoverSeq uint32
+	// lost is the number of packets in flight marked lost
+	lost int
+	// lastAckAt is when a packet was last acknowledged; probed is set once
+	// a tail loss probe was sent since
+	lastAckAt time.Time
+	probed    bool
+	// lastAckedSentAt is when the most recently sent of the acknowledged
+	// packets was sent, to tell losses from reordering
+	lastAckedSentAt time.Time
+	sendNext        uint32
+	sendUnacked     uint32
+	inFlight        map[uint32]*segment
+
+	receiveNext     uint32
+	highestReceived uint32
+	outOfOrder      map[uint32]*packet
+	readBuffer      bytes.Buffer
+	eof             bool
+
+	err           error
+	closing       bool
+	done          bool
+	stop          chan struct{}
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// options are the settings a Dialer or ListenConfig gives its connections.
+type options struct {
+	window     int
+	congestion func() CongestionControl
+	trace      *Trace
+	pace       func(n int)
+}
+
+// newConn starts a connection whose own sequence numbers start after isn.
+// A window of zero or less is DefaultWindow, and Reno is the default
+// congestion control. Every packet passes through the pace hook, if any.
+func newConn(peer *net.UDPAddr, local net.Addr, send func(data []byte) error, isn uint32, opts options) *Conn {
+	if opts.window <= 0 {
+		opts.window = DefaultWindow
+	}
+	if opts.congestion == nil {
+		opts.congestion = NewReno
+	}
+	if opts.pace != nil {
+		write := send
+		send = func(data []byte) error {
+			opts.pace(len(data))
+			return write(data)
+		}
+	}
+	conn := &Conn{
+		peer:        peer,
+		local:       local,
+		send:        send,
+		window:      opts.window,
+		congestion:  opts.congestion(),
+		trace:       opts.trace,
+		stats:       Stats{RTO: initialRTO},
+		sendNext:    isn + 1,
+		sendUnacked: isn + 1,
+		inFlight:    map[uint32]*segment{},
+		outOfOrder:  map[uint32]*packet{},
+		stop:        make(chan struct{}),
+
+		handshakeDeadline: time.Now().Add(handshakeTimeout),
+	}
+	conn.cond = sync.NewCond(&conn.mutex)
+	go conn.timerLoop()
+	return conn
+}
+
+func (conn *Conn) Read(buffer []byte) (int, error) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	for conn.readBuffer.Len() == 0 && !conn.eof && conn.err == nil && !conn.closing {
+		if !conn.wait(conn.readDeadline) {
+			return 0, timeoutError{}
+		}
+	}
+	switch {
+	case conn.closing:
+		return 0, ErrClosed
+	case conn.readBuffer.Len() > 0:
+		return conn.readBuffer.Read(buffer)
+	case conn.eof:
+		return 0, io.EOF
+	}
+	return 0, conn.err
+}
+
+// Write returns once data is sent, not acknowledged. It blocks while the
+// send or congestion window is full.
+func (conn *Conn) Write(data []byte) (int, error) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	written := 0
+	for written < len(data) {
+		for conn.windowFull() && conn.err == nil && !conn.closing {
+			if !conn.wait(conn.writeDeadline) {
+				return written, timeoutError{}
+			}
+		}
+		if conn.closing {
+			return written, ErrClosed
+		}
+		if conn.err != nil {
+			return written, conn.err
+		}
+
+		end := written + MaxPayloadSize
+		if end > len(data) {
+			end = len(data)
+		}
+		payload := make([]byte, end-written)
+		copy(payload, data[written:end])
+		conn.queue(typeData, payload)
+		written = end
+	}
+	return written, nil
+}
+
+// Close sends everything still unacknowledged and a FIN, and waits for
+// their ACK unless the peer has closed already.
+func (conn *Conn) Close() error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	if conn.closing {
+		return ErrClosed
+	}
+	conn.closing = true
+	conn.cond.Broadcast()
+
+	if conn.established && conn.err == nil && !conn.done {
+		conn.queue(typeFin, nil)
+		// a peer that sent its FIN reads nothing more
+		for len(conn.inFlight) > 0 && conn.err == nil && !conn.eof {
+			conn.wait(time.Time{})
+		}
+	}
+	conn.teardown()
+	return nil
+}
+
+func (conn *Conn) LocalAddr() net.Addr {
+	return conn.local
+}
+
+func (conn *Conn) RemoteAddr() net.Addr {
+	return conn.peer
+}
+
+func (conn *Conn) SetDeadline(deadline time.Time) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.readDeadline = deadline
+	conn.writeDeadline = deadline
+	conn.cond.Broadcast()
+	return nil
+}
+
+func (conn *Conn) SetReadDeadline(deadline time.Time) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.readDeadline = deadline
+	conn.cond.Broadcast()
+	return nil
+}
+
+func (conn *Conn) SetWriteDeadline(deadline time.Time) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.writeDeadline = deadline
+	conn.cond.Broadcast()
+	return nil
+}
+
+// wait releases the lock until the state changes or deadline passes. It
+// returns false once the deadline has passed.
+func (conn *Conn) wait(deadline time.Time) bool {
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false
+		}
+		timer := time.AfterFunc(remaining, func() {
+			conn.mutex.Lock()
+			conn.cond.Broadcast()
+			conn.mutex.Unlock()
+		})
+		defer timer.Stop()
+	}
+	conn.cond.Wait()
+	return true
+}
+
+// queue assigns the next sequence number to a data or FIN packet and sends it.
+func (conn *Conn) queue(kind byte, payload []byte) {
+	seg := &segment{kind: kind, seq: conn.sendNext, payload: payload}
+	conn.inFlight[seg.seq] = seg
+	conn.sendNext++
+	conn.transmit(seg)
+}
+
+func (conn *Conn) transmit(seg *segment) {
+	if !seg.sentAt.IsZero() {
+		seg.retransmitted = true
+		conn.stats.Retransmits++
+	}
+	if seg.lost {
+		seg.lost = false
+		conn.lost--
+	}
+	seg.nacked = false
+	seg.sentAt = time.Now()
+	conn.sendPacket(seg.kind, seg.seq, seg.payload)
+}
+
+func (conn *Conn) sendPacket(kind byte, seq uint32, payload []byte) {
+	// a lost datagram is recovered like a dropped one
+	_ = conn.send((&packet{kind: kind, seq: seq, peer: conn.peer, payload: payload}).marshal())
+}
+
+// sendHandshake sends a SYN or SYN-ACK, noting when for the first round-trip
+// time sample.
+func (conn *Conn) sendHandshake(p *packet) {
+	if conn.handshakeSentAt.IsZero() {
+		conn.handshakeSentAt = time.Now()
+	} else {
+		conn.handshakeRetried = true
+	}
+	conn.handshakeResendAt = time.Now().Add(conn.stats.RTO)
+	conn.sendPacket(p.kind, p.seq, p.payload)
+}
+
+// handle processes a packet received for this connection.
+func (conn *Conn) handle(p *packet) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	defer conn.cond.Broadcast()
+	if conn.done {
+		return
+	}
+
+	switch p.kind {
+	case typeSyn:
+		// our SYN-ACK was lost
+		if conn.synAck != nil && !conn.established {
+			conn.sendHandshake(conn.synAck)
+		}
+	case typeSynAck:
+		if len(p.payload) == 4 && binary.BigEndian.Uint32(p.payload) == conn.sendNext {
+			if !conn.established {
+				conn.receiveNext = p.seq + 1
+				conn.highestReceived = p.seq
+			}
+			conn.establish()
+		}
+		if conn.established {
+			conn.sendPacket(typeAck, conn.receiveNext, nil)
+		}
+	case typeAck:
+		conn.establish()
+		if len(p.payload) == 4 {
+			conn.acknowledgeOne(binary.BigEndian.Uint32(p.payload))
+		}
+		conn.acknowledge(p.seq)
+		conn.detectLosses()
+	case typeNak:
+		if seg := conn.inFlight[p.seq]; seg != nil {
+			seg.nacked = true
+			conn.detectLosses()
+		}
+	case typeData, typeFin:
+		conn.establish()
+		conn.receive(p)
+	}
+}
+
+func (conn *Conn) establish() {
+	if conn.established {
+		return
+	}
+	conn.established = true
+	if !conn.handshakeSentAt.IsZero() && !conn.handshakeRetried {
+		conn.sampleRTT(time.Since(conn.handshakeSentAt))
+	}
+	if conn.onEstablish != nil {
+		conn.onEstablish(conn)
+	}
+}
+
+// acknowledge drops the packets before next, the cumulative ACK.
+func (conn *Conn) acknowledge(next uint32) {
+	if seqAfter(next, conn.sendNext) {
+		return
+	}
+	for ; seqBefore(conn.sendUnacked, next); conn.sendUnacked++ {
+		if seg := conn.inFlight[conn.sendUnacked]; seg != nil {
+			conn.acked(seg)
+		}
+	}
+	conn.slideWindow()
+}
+
+// acknowledgeOne drops a single packet the peer received, possibly ahead of
+// a gap.
+func (conn *Conn) acknowledgeOne(seq uint32) {
+	if seq-conn.sendUnacked >= conn.sendNext-conn.sendUnacked {
+		return
+	}
+	if seg := conn.inFlight[seq]; seg != nil {
+		if !seg.retransmitted {
+			conn.sampleRTT(time.Since(seg.sentAt))
+		}
+		conn.acked(seg)
+	}
+	conn.slideWindow()
+}
+
+// acked drops an acknowledged packet and grows the congestion window, unless
+// the send window is the limit anyway.
+func (conn *Conn) acked(seg *segment) {
+	delete(conn.inFlight, seg.seq)
+	if seg.lost {
+		conn.lost--
+	}
+	conn.lastAckAt = time.Now()
+	conn.probed = false
+	if seg.sentAt.After(conn.lastAckedSentAt) {
+		conn.lastAckedSentAt = seg.sentAt
+	}
+	if conn.congestion.Window() < float64(conn.window) {
+		conn.congestion.OnAck(time.Now())
+		conn.trace.log(conn, "ack")
+	}
+}
+
+// detectLosses marks packets lost rather than reordered: NAKed, or passed by
+// a packet sent after them and acknowledged, whether or not the NAK made it,
+// and overdue by the variation of the round-trip time (as RACK, RFC 8985,
+// does). It then sends lost packets again.
+func (conn *Conn) detectLosses() {
+	overdue := conn.stats.SRTT + 4*conn.stats.RTTVar
+	for seq := conn.sendUnacked; seq != conn.sendNext; seq++ {
+		seg := conn.inFlight[seq]
+		if seg == nil || seg.lost || !(seg.nacked || seg.sentAt.Before(conn.lastAckedSentAt)) ||
+			time.Since(seg.sentAt) < overdue {
+			continue
+		}
+		conn.congestionEvent("loss")
+		conn.markLost(seg)
+	}
+	conn.retransmitLost()
+}
+
+// markLost takes a packet out of the pipe until it is sent again.
+func (conn *Conn) markLost(seg *segment) {
+	if !seg.lost {
+		seg.lost = true
+		conn.lost++
+	}
+}
+
+// retransmitLost sends lost packets again, oldest first, while the
+// congestion window has room.
+func (conn *Conn) retransmitLost() {
+	for seq := conn.sendUnacked; conn.lost > 0 && seq != conn.sendNext; seq++ {
+		if float64(conn.pipe()) >= conn.congestion.Window() {
+			return
+		}
+		if seg := conn.inFlight[seq]; seg != nil && seg.lost {
+			conn.transmit(seg)
+		}
+	}
+}
+
+// pipe is the number of packets thought to be in the network.
+func (conn *Conn) pipe() int {
+	return len(conn.inFlight) - conn.lost
+}
+
+// congestionEvent reports a loss or timeout to the congestion control, once
+// per window of data: packets sent before the loss are not new losses.
+func (conn *Conn) congestionEvent(event string) {
+	if conn.inRecovery {
+		return
+	}
+	conn.inRecovery = true
+	conn.recoverSeq = conn.sendNext
+	if event == "timeout" {
+		conn.congestion.OnTimeout(time.Now())
+	} else {
+		conn.congestion.OnLoss(time.Now())
+	}
+	conn.trace.log(conn, event)
+}
+
+func (conn *Conn) windowFull() bool {
+	return int(conn.sendNext-conn.sendUnacked) >= conn.window ||
+		conn.lost > 0 || float64(conn.pipe()) >= conn.congestion.Window()
+}
+
+// slideWindow moves the window past the packets acknowledged out of order.
+func (conn *Conn) slideWindow() {
+	for conn.sendUnacked != conn.sendNext && conn.inFlight[conn.sendUnacked] == nil {
+		conn.sendUnacked++
+	}
+	if conn.inRecovery && !seqBefore(conn.sendUnacked, conn.recoverSeq) {
+		conn.inRecovery = false
+	}
+}
+
+// receive buffers a data or FIN packet, delivers what is now in order and
+// acknowledges it. Packets skipped over since the last one are NAKed once.
+func (conn *Conn) receive(p *packet) {
+	switch {
+	case p.seq == conn.receiveNext:
+		conn.deliver(p)
+		for next := conn.outOfOrder[conn.receiveNext]; next != nil; next = conn.outOfOrder[conn.receiveNext] {
+			delete(conn.outOfOrder, next.seq)
+			conn.deliver(next)
+		}
+	case p.seq-conn.receiveNext < maxOutOfOrder:
+		if _, seen := conn.outOfOrder[p.seq]; !seen {
+			conn.outOfOrder[p.seq] = p
+		}
+		first := conn.receiveNext
+		if !seqBefore(conn.highestReceived, first) {
+			first = conn.highestReceived + 1
+		}
+		for missing := first; seqBefore(missing, p.seq); missing++ {
+			conn.sendPacket(typeNak, missing, nil)
+		}
+	}
+	if seqAfter(p.seq, conn.highestReceived) {
+		conn.highestReceived = p.seq
+	}
+	received := make([]byte, 4)
+	binary.BigEndian.PutUint32(received, p.seq)
+	conn.sendPacket(typeAck, conn.receiveNext, received)
+}
+
+func (conn *Conn) deliver(p *packet) {
+	conn.receiveNext++
+	if conn.eof {
+		return
+	}
+	if p.kind == typeFin {
+		conn.eof = true
+		return
+	}
+	conn.readBuffer.Write(p.payload)
+}
+
+// timerLoop sends the oldest packet whose timer ran out again, marks the
+// others in flight lost and backs the timeout off.
+func (conn *Conn) timerLoop() {
+	ticker := time.NewTicker(timerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-conn.stop:
+			return
+		case <-ticker.C:
+		}
+
+		conn.mutex.Lock()
+		if !conn.established && !conn.done && time.Now().After(conn.handshakeDeadline) {
+			conn.fail(ErrPeerUnreachable)
+		}
+		// the ACK of our SYN-ACK was lost, and the peer may only be waiting
+		// for data
+		if !conn.established && !conn.done && conn.synAck != nil && time.Now().After(conn.handshakeResendAt) {
+			conn.backoff()
+			conn.sendHandshake(conn.synAck)
+		}
+		conn.detectLosses()
+		conn.probeTail()
+		var oldest *segment
+		for seq := conn.sendUnacked; seq != conn.sendNext; seq++ {
+			if seg := conn.inFlight[seq]; seg != nil && !seg.lost && time.Since(seg.sentAt) >= conn.stats.RTO {
+				oldest = seg
+				break
+			}
+		}
+		if oldest != nil {
+			// as after a TCP timeout, nothing sent is thought to be in the
+			// network any more
+			for _, seg := range conn.inFlight {
+				if seg != oldest {
+					conn.markLost(seg)
+				}
+			}
+			conn.backoff()
+			// a timeout is news even during recovery from a loss
+			conn.inRecovery = false
+			conn.congestionEvent("timeout")
+			oldest.retransmits++
+			if oldest.retransmits > maxRetransmits {
+				conn.fail(ErrPeerUnreachable)
+			} else {
+				conn.transmit(oldest)
+				// one probe per timeout, should the retransmission or its ACK
+				// be lost too
+				conn.probed = false
+				conn.retransmitLost()
+			}
+		}
+		conn.mutex.Unlock()
+	}
+}
+
+// probeTail sends the newest packet in flight again when nothing was
+// acknowledged for two round-trip times, so that losses at the end of a
+// flight or of retransmissions are detected without waiting for the
+// retransmission timer (as TLP, RFC 8985, does).
+func (conn *Conn) probeTail() {
+	if conn.probed || conn.pipe() == 0 || conn.stats.Samples == 0 {
+		return
+	}
+	timeout := 2 * conn.stats.SRTT
+	if timeout < timerInterval {
+		timeout = timerInterval
+	}
+	if time.Since(conn.lastAckAt) < timeout {
+		return
+	}
+	for seq := conn.sendNext - 1; seq != conn.sendUnacked-1; seq-- {
+		if seg := conn.inFlight[seq]; seg != nil && !seg.lost {
+			if time.Since(seg.sentAt) >= timeout {
+				conn.probed = true
+				conn.transmit(seg)
+			}
+			return
+		}
+	}
+}
+
+// fail ends the connection with err, which the next Read or Write returns.
+func (conn *Conn) fail(err error) {
+	if conn.err == nil {
+		conn.err = err
+	}
+	conn.teardown()
+	conn.cond.Broadcast()
+}
+
+// teardown stops the timers and releases the socket or listener entry.
+func (conn *Conn) teardown() {
+	if conn.done {
+		return
+	}
+	conn.done = true
+	close(conn.stop)
+	if conn.release != nil {
+		go conn.release()
+	}
+}
@@ -0,0 +1,254 @@
+package rudp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyRouter forwards packets like cmd/router: it swaps the peer address
+// of the header for the sender's, drops some packets and delays the others
+// by a random amount, which reorders them.
+type lossyRouter struct {
+	socket   *net.UDPConn
+	dropRate float64
+	maxDelay time.Duration
+
+	mutex  sync.Mutex
+	random *rand.Rand
+}
+
+func startRouter(t *testing.T, dropRate float64, maxDelay time.Duration) string {
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := &lossyRouter{socket: socket, dropRate: dropRate, maxDelay: maxDelay, random: rand.New(rand.NewSource(1))}
+	go router.forward()
+	t.Cleanup(func() { socket.Close() })
+	return socket.LocalAddr().String()
+}
+
+func (router *lossyRouter) forward() {
+	buffer := make([]byte, 2*MaxPacketSize)
+	for {
+		n, from, err := router.socket.ReadFromUDP(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n < HeaderSize {
+			continue
+		}
+		data := make([]byte, n)
+		copy(data, buffer[:n])
+		to := &net.UDPAddr{IP: net.IP(data[5:9]), Port: int(binary.BigEndian.Uint16(data[9:11]))}
+		copy(data[5:9], from.IP.To4())
+		binary.BigEndian.PutUint16(data[9:11], uint16(from.Port))
+
+		router.mutex.Lock()
+		drop := router.random.Float64() < router.dropRate
+		var delay time.Duration
+		if router.maxDelay > 0 {
+			delay = time.Duration(router.random.Int63n(int64(router.maxDelay)))
+		}
+		router.mutex.Unlock()
+		if drop {
+			continue
+		}
+		time.AfterFunc(delay, func() { _, _ = router.socket.WriteToUDP(data, to) })
+	}
+}
+
+// transfer sends size bytes from a listener to a dialer through the router
+// and checks they arrive whole and in order.
+func transfer(t *testing.T, router string, size int, congestion func() CongestionControl) {
+	listener, err := (&ListenConfig{Congestion: congestion}).Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	data := make([]byte, size)
+	rand.New(rand.NewSource(2)).Read(data)
+	sent := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			sent <- err
+			return
+		}
+		if _, err := conn.Write(data); err != nil {
+			sent <- err
+			return
+		}
+		sent <- conn.Close()
+	}()
+
+	dialer := &Dialer{Router: router, Timeout: 10 * time.Second, Congestion: congestion}
+	conn, err := dialer.Dial("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	received, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatalf("received %d bytes, not the %d sent in order", len(received), len(data))
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransferUnderLossAndReordering(t *testing.T) {
+	router := startRouter(t, 0.1, 5*time.Millisecond)
+	for name, congestion := range map[string]func() CongestionControl{
+		CongestionReno:  NewReno,
+		CongestionCubic: NewCubic,
+		CongestionNone:  NewFixedWindow,
+	} {
+		t.Run(name, func(t *testing.T) {
+			transfer(t, router, 100*MaxPayloadSize+17, congestion)
+		})
+	}
+}
+
+func TestTransferAcrossWrapAround(t *testing.T) {
+	defer func(original func() uint32) { randomISN = original }(randomISN)
+	randomISN = func() uint32 { return 1<<32 - 20 }
+
+	router := startRouter(t, 0.1, 5*time.Millisecond)
+	transfer(t, router, 60*MaxPayloadSize, NewReno)
+}
+
+func TestSeqBeforeWraps(t *testing.T) {
+	cases := []struct {
+		a, b uint32
+		want bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{1, 1, false},
+		{1<<32 - 1, 0, true},
+		{0, 1<<32 - 1, false},
+		{1<<32 - 10, 5, true},
+	}
+	for _, c := range cases {
+		if got := seqBefore(c.a, c.b); got != c.want {
+			t.Errorf("seqBefore(%d, %d) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+// unconnected returns a connection whose packets go nowhere, to drive by
+// hand.
+func unconnected(t *testing.T) *Conn {
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	conn := newConn(peer, peer, func(data []byte) error { return nil }, 1<<32-1, options{})
+	t.Cleanup(func() {
+		conn.mutex.Lock()
+		conn.fail(ErrClosed)
+		conn.mutex.Unlock()
+	})
+	return conn
+}
+
+func ackFor(seq uint32, next uint32) *packet {
+	received := make([]byte, 4)
+	binary.BigEndian.PutUint32(received, seq)
+	return &packet{kind: typeAck, seq: next, payload: received}
+}
+
+func TestKarnSkipsRetransmittedPackets(t *testing.T) {
+	conn := unconnected(t)
+	if _, err := conn.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	conn.mutex.Lock()
+	first := conn.inFlight[0]
+	conn.transmit(first)
+	conn.mutex.Unlock()
+	conn.handle(ackFor(0, 1))
+	if stats := conn.Stats(); stats.Samples != 0 || stats.Retransmits != 1 {
+		t.Fatalf("after a retransmitted packet: %s, want no sample", stats)
+	}
+
+	if _, err := conn.Write([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	conn.handle(ackFor(1, 2))
+	stats := conn.Stats()
+	if stats.Samples != 1 {
+		t.Fatalf("after a packet sent once: %s, want a sample", stats)
+	}
+	if stats.SRTT < 5*time.Millisecond || stats.RTO < minRTO {
+		t.Fatalf("sample not taken from the packet: %s", stats)
+	}
+}
+
+func TestTimeoutResendsOnlyTheOldestPacket(t *testing.T) {
+	conn := unconnected(t)
+	for i := 0; i < 3; i++ {
+		if _, err := conn.Write([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.mutex.Lock()
+	conn.stats.RTO = minRTO
+	conn.mutex.Unlock()
+	time.Sleep(minRTO + 3*timerInterval)
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	if conn.stats.Timeouts != 1 {
+		t.Fatalf("%d timeouts, want 1", conn.stats.Timeouts)
+	}
+	if !conn.inFlight[0].retransmitted || conn.inFlight[0].lost {
+		t.Fatal("the oldest packet was not sent again")
+	}
+	for seq := uint32(1); seq < 3; seq++ {
+		if seg := conn.inFlight[seq]; seg.retransmitted || !seg.lost {
+			t.Fatalf("packet %d: retransmitted %v, lost %v, want it to wait for the window", seq, seg.retransmitted, seg.lost)
+		}
+	}
+	if conn.congestion.Window() != 1 {
+		t.Fatalf("cwnd %.2f after a timeout, want 1", conn.congestion.Window())
+	}
+}
+
+func TestPaceSeesEveryPacket(t *testing.T) {
+	var paced []int
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	conn := newConn(peer, peer, func(data []byte) error { return nil }, 0, options{pace: func(n int) { paced = append(paced, n) }})
+	defer func() {
+		conn.mutex.Lock()
+		conn.fail(ErrClosed)
+		conn.mutex.Unlock()
+	}()
+
+	if _, err := conn.Write(make([]byte, MaxPayloadSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	conn.mutex.Lock()
+	conn.transmit(conn.inFlight[1])
+	conn.mutex.Unlock()
+
+	want := []int{HeaderSize + MaxPayloadSize, HeaderSize + 1, HeaderSize + MaxPayloadSize}
+	if !reflect.DeepEqual(paced, want) {
+		t.Fatalf("paced %v, want both packets and the retransmission %v", paced, want)
+	}
+}
@@ -0,0 +1,133 @@
+package rudp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Dialer opens connections through a router. It can serve as the
+// DialContext of a net/http Transport.
+type Dialer struct {
+	// Router is the host:port packets are sent to. When empty they go
+	// straight to the peer.
+	Router string
+	// Timeout bounds the handshake; zero means until the retransmissions
+	// run out.
+	Timeout time.Duration
+	// Window is the number of packets sent ahead of the oldest
+	// unacknowledged one; zero means DefaultWindow.
+	Window int
+	// Congestion creates the congestion control of each connection; nil
+	// means NewReno.
+	Congestion func() CongestionControl
+	// Trace, when set, receives the congestion window of each connection.
+	Trace *Trace
+	// Pace, when set, is called with the size of every packet before it is
+	// sent, retransmissions and probes included, and may block to hold the
+	// connection to a rate.
+	Pace func(n int)
+}
+
+// Dial connects to address, a host:port resolving to IPv4, through the
+// router at router.
+func Dial(router string, address string) (*Conn, error) {
+	dialer := &Dialer{Router: router}
+	return dialer.dial(context.Background(), address)
+}
+
+// Dial ignores network, the connection is always over UDP.
+func (dialer *Dialer) Dial(network string, address string) (net.Conn, error) {
+	return dialer.DialContext(context.Background(), network, address)
+}
+
+func (dialer *Dialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	conn, err := dialer.dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (dialer *Dialer) dial(ctx context.Context, address string) (*Conn, error) {
+	peer, err := resolveIPv4(address)
+	if err != nil {
+		return nil, err
+	}
+	via := peer
+	if dialer.Router != "" {
+		if via, err = resolveIPv4(dialer.Router); err != nil {
+			return nil, err
+		}
+	}
+	socket, err := net.DialUDP("udp4", nil, via)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := newConn(peer, socket.LocalAddr(), func(data []byte) error {
+		_, err := socket.Write(data)
+		return err
+	}, randomISN(), options{window: dialer.Window, congestion: dialer.Congestion, trace: dialer.Trace, pace: dialer.Pace})
+	conn.release = func() { socket.Close() }
+	go readLoop(socket, conn)
+
+	deadline := time.Now().Add(handshakeTimeout)
+	if dialer.Timeout > 0 {
+		deadline = time.Now().Add(dialer.Timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.handshakeDeadline = deadline
+	syn := &packet{kind: typeSyn, seq: conn.sendNext - 1}
+	for !conn.established {
+		if ctx.Err() != nil || !time.Now().Before(deadline) || conn.err != nil {
+			conn.fail(ErrClosed)
+			return nil, fmt.Errorf("rudp: no answer from %s: handshake timed out", address)
+		}
+		if !conn.handshakeSentAt.IsZero() {
+			conn.backoff()
+		}
+		conn.sendHandshake(syn)
+		retry := time.Now().Add(conn.stats.RTO)
+		if retry.After(deadline) {
+			retry = deadline
+		}
+		for !conn.established && conn.err == nil && conn.wait(retry) {
+		}
+	}
+	return conn, nil
+}
+
+// readLoop feeds the packets of a dialed socket to its connection until
+// the socket is closed.
+func readLoop(socket *net.UDPConn, conn *Conn) {
+	buffer := make([]byte, 2*MaxPacketSize)
+	for {
+		n, err := socket.Read(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if p, err := parsePacket(buffer[:n]); err == nil {
+			conn.handle(p)
+		}
+	}
+}
+
+// synAckFor builds the SYN-ACK answering a SYN: our initial sequence number,
+// with the one we expect next from the peer as payload.
+func synAckFor(syn *packet, isn uint32) *packet {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, syn.seq+1)
+	return &packet{kind: typeSynAck, seq: isn, payload: payload}
+}
@@ -0,0 +1,166 @@
+package rudp
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// backlog is the number of established connections waiting for Accept.
+const backlog = 128
+
+// ListenConfig holds the options of the connections a Listener accepts.
+type ListenConfig struct {
+	// Window is the send window of every connection; zero means
+	// DefaultWindow.
+	Window int
+	// Congestion creates the congestion control of each connection; nil
+	// means NewReno.
+	Congestion func() CongestionControl
+	// Trace, when set, receives the congestion window of each connection.
+	Trace *Trace
+	// Pace, when set, is called with the size of every packet before it is
+	// sent, as for a Dialer. The connections share it.
+	Pace func(n int)
+}
+
+// Listener accepts connections on one UDP socket. Packets are told apart by
+// the address they came from and the peer address in their header, so many
+// clients can share the router.
+type Listener struct {
+	socket  *net.UDPConn
+	options options
+
+	mutex    sync.Mutex
+	conns    map[string]*Conn
+	accepted chan *Conn
+	closed   bool
+	done     chan struct{}
+}
+
+// Listen listens on the UDP address, eg. "127.0.0.1:8080".
+func Listen(address string) (*Listener, error) {
+	return (&ListenConfig{}).Listen(address)
+}
+
+func (config *ListenConfig) Listen(address string) (*Listener, error) {
+	addr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+	socket, err := net.ListenUDP("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	listener := &Listener{
+		socket:   socket,
+		options:  options{window: config.Window, congestion: config.Congestion, trace: config.Trace, pace: config.Pace},
+		conns:    map[string]*Conn{},
+		accepted: make(chan *Conn, backlog),
+		done:     make(chan struct{}),
+	}
+	go listener.readLoop()
+	return listener, nil
+}
+
+// Accept returns the next connection whose handshake completed.
+func (listener *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-listener.accepted:
+		return conn, nil
+	case <-listener.done:
+		return nil, ErrClosed
+	}
+}
+
+// Close stops accepting and ends every connection, which share its socket.
+func (listener *Listener) Close() error {
+	listener.mutex.Lock()
+	if listener.closed {
+		listener.mutex.Unlock()
+		return ErrClosed
+	}
+	listener.closed = true
+	close(listener.done)
+	conns := make([]*Conn, 0, len(listener.conns))
+	for _, conn := range listener.conns {
+		conns = append(conns, conn)
+	}
+	listener.mutex.Unlock()
+
+	for _, conn := range conns {
+		conn.mutex.Lock()
+		conn.fail(ErrClosed)
+		conn.mutex.Unlock()
+	}
+	return listener.socket.Close()
+}
+
+func (listener *Listener) Addr() net.Addr {
+	return listener.socket.LocalAddr()
+}
+
+func (listener *Listener) readLoop() {
+	buffer := make([]byte, 2*MaxPacketSize)
+	for {
+		n, from, err := listener.socket.ReadFromUDP(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		p, err := parsePacket(buffer[:n])
+		if err != nil {
+			continue
+		}
+		if conn := listener.lookup(from, p); conn != nil {
+			conn.handle(p)
+		}
+	}
+}
+
+// lookup finds the connection of a packet, creating it for a SYN.
+func (listener *Listener) lookup(from *net.UDPAddr, p *packet) *Conn {
+	key := from.String() + "/" + p.peer.String()
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	if conn := listener.conns[key]; conn != nil || listener.closed {
+		return conn
+	}
+
+	switch p.kind {
+	case typeSyn:
+		conn := newConn(p.peer, listener.socket.LocalAddr(), func(data []byte) error {
+			_, err := listener.socket.WriteToUDP(data, from)
+			return err
+		}, randomISN(), listener.options)
+		conn.receiveNext = p.seq + 1
+		conn.highestReceived = p.seq
+		conn.synAck = synAckFor(p, conn.sendNext-1)
+		conn.onEstablish = func(conn *Conn) {
+			select {
+			case listener.accepted <- conn:
+			default:
+				conn.fail(ErrClosed)
+			}
+		}
+		conn.release = func() { listener.remove(key, conn) }
+		listener.conns[key] = conn
+		return conn
+	case typeFin:
+		// the connection is gone, but the peer still waits for its FIN to
+		// be acknowledged
+		ack := &packet{kind: typeAck, seq: p.seq + 1, peer: p.peer}
+		_, _ = listener.socket.WriteToUDP(ack.marshal(), from)
+	}
+	return nil
+}
+
+func (listener *Listener) remove(key string, conn *Conn) {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	if listener.conns[key] == conn {
+		delete(listener.conns, key)
+	}
+}
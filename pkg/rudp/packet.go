@@ -0,0 +1,101 @@
+package rudp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Packet types. The router only looks at the peer address, the type and
+// sequence number are ours.
+const (
+	typeData   byte = 0
+	typeAck    byte = 1
+	typeSyn    byte = 2
+	typeSynAck byte = 3
+	typeNak    byte = 4
+	typeFin    byte = 5
+)
+
+const (
+	// HeaderSize is type (1), sequence number (4), peer IPv4 address (4) and
+	// peer port (2).
+	HeaderSize = 11
+	// MaxPacketSize is the largest packet the router forwards.
+	MaxPacketSize = 1024
+	// MaxPayloadSize is the data a single packet carries.
+	MaxPayloadSize = MaxPacketSize - HeaderSize
+)
+
+// packet is one datagram. peer is the other end of the connection: the
+// destination when sending, the source once the router has rewritten it.
+type packet struct {
+	kind    byte
+	seq     uint32
+	peer    *net.UDPAddr
+	payload []byte
+}
+
+func (p *packet) marshal() []byte {
+	data := make([]byte, HeaderSize+len(p.payload))
+	data[0] = p.kind
+	binary.BigEndian.PutUint32(data[1:5], p.seq)
+	copy(data[5:9], p.peer.IP.To4())
+	binary.BigEndian.PutUint16(data[9:11], uint16(p.peer.Port))
+	copy(data[HeaderSize:], p.payload)
+	return data
+}
+
+func parsePacket(data []byte) (*packet, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("packet too short: %d bytes", len(data))
+	}
+	payload := make([]byte, len(data)-HeaderSize)
+	copy(payload, data[HeaderSize:])
+	return &packet{
+		kind: data[0],
+		seq:  binary.BigEndian.Uint32(data[1:5]),
+		peer: &net.UDPAddr{
+			IP:   net.IPv4(data[5], data[6], data[7], data[8]),
+			Port: int(binary.BigEndian.Uint16(data[9:11])),
+		},
+		payload: payload,
+	}, nil
+}
+
+// resolveIPv4 resolves address to the IPv4 address the packet header holds.
+func resolveIPv4(address string) (*net.UDPAddr, error) {
+	addr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+	if addr.IP == nil {
+		addr.IP = net.IPv4(127, 0, 0, 1)
+	}
+	if addr.IP.To4() == nil {
+		return nil, fmt.Errorf("%s is not an IPv4 address", address)
+	}
+	return addr, nil
+}
+
+// seqBefore tells whether sequence number a comes before b, across
+// wrap-around (serial number arithmetic, RFC 1982).
+func seqBefore(a uint32, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+func seqAfter(a uint32, b uint32) bool {
+	return seqBefore(b, a)
+}
+
+// randomISN picks an initial sequence number, so packets left over from an
+// earlier connection are unlikely to fit in a new one. Tests replace it to
+// start near wrap-around.
+var randomISN = func() uint32 {
+	var isn [4]byte
+	if _, err := rand.Read(isn[:]); err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(isn[:])
+}
@@ -0,0 +1,79 @@
+package rudp
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retransmission timeout bounds, as in RFC 6298 except for a lower minimum
+// suited to the router's delays.
+const (
+	initialRTO = time.Second
+	minRTO     = 200 * time.Millisecond
+	maxRTO     = 60 * time.Second
+)
+
+// Stats describes the round-trip time estimation of a connection.
+type Stats struct {
+	// SRTT and RTTVar are the smoothed round-trip time and its variation,
+	// zero until the first sample.
+	SRTT   time.Duration
+	RTTVar time.Duration
+	// RTO is the current retransmission timeout, backoff included.
+	RTO time.Duration
+	// Samples is the number of round-trip times measured.
+	Samples int
+	// Timeouts counts retransmission timer expiries, Retransmits the packets
+	// sent again, for timeouts or NAKs.
+	Timeouts    int
+	Retransmits int
+}
+
+// Stats returns the round-trip time statistics so far.
+func (conn *Conn) Stats() Stats {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.stats
+}
+
+func (stats Stats) String() string {
+	return fmt.Sprintf("srtt=%s rttvar=%s rto=%s samples=%d timeouts=%d retransmits=%d",
+		stats.SRTT.Round(time.Microsecond), stats.RTTVar.Round(time.Microsecond), stats.RTO.Round(time.Microsecond),
+		stats.Samples, stats.Timeouts, stats.Retransmits)
+}
+
+// sampleRTT updates the estimate with Jacobson/Karels. The caller keeps to
+// Karn's algorithm: retransmitted packets are not sampled.
+func (conn *Conn) sampleRTT(rtt time.Duration) {
+	stats := &conn.stats
+	if stats.Samples == 0 {
+		stats.SRTT = rtt
+		stats.RTTVar = rtt / 2
+	} else {
+		delta := stats.SRTT - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		stats.RTTVar = (3*stats.RTTVar + delta) / 4
+		stats.SRTT = (7*stats.SRTT + rtt) / 8
+	}
+	stats.Samples++
+
+	// a fresh sample also ends any backoff
+	stats.RTO = stats.SRTT + 4*stats.RTTVar
+	if stats.RTO < minRTO {
+		stats.RTO = minRTO
+	}
+	if stats.RTO > maxRTO {
+		stats.RTO = maxRTO
+	}
+}
+
+// backoff doubles the timeout after a retransmission timer ran out.
+func (conn *Conn) backoff() {
+	conn.stats.Timeouts++
+	conn.stats.RTO *= 2
+	if conn.stats.RTO > maxRTO {
+		conn.stats.RTO = maxRTO
+	}
+}